@@ -1,18 +1,74 @@
 package config
 
+import "time"
+
 var (
 	// PORT on which app will run
 	PORT string
 
 	// REPO_BASE_DIR base directory where all repos will reside
 	REPO_BASE_DIR string
+
+	// TRASH_RETENTION how long a deleted repo is kept in trash before being purged
+	TRASH_RETENTION = DefaultTrashRetention
+
+	// RENAME_REDIRECT_TTL how long git requests to the old name of a renamed repo are redirected, 0 disables it
+	RENAME_REDIRECT_TTL time.Duration
 )
 
-// PerPageCommitCount max number of commits to show on /log at a time
+// PerPageCommitCount default number of commits to show on /log at a time
 const PerPageCommitCount int64 = 1000
 
-// CommitSeparator used to split git log commits output
-const CommitSeparator string = "^^$$^^$$"
+// MaxPerPageCommitCount max number of commits which can be asked with per_page on /log at a time
+const MaxPerPageCommitCount int64 = 1000
+
+// TrashDirName directory inside REPO_BASE_DIR where deleted repos are moved
+const TrashDirName string = ".trash"
+
+// DefaultTrashRetention default time for which deleted repos can be restored
+const DefaultTrashRetention time.Duration = 7 * 24 * time.Hour
+
+// TrashPurgeInterval how often expired repos are purged from trash
+const TrashPurgeInterval time.Duration = time.Hour
+
+// PerPageRepoCount default number of repos to show on /repos at a time
+const PerPageRepoCount int64 = 30
+
+// MaxPerPageRepoCount max number of repos which can be asked on /repos at a time
+const MaxPerPageRepoCount int64 = 100
+
+// CommitAuthorName name used for commits created by the server when no author is given
+const CommitAuthorName string = "gitbox"
+
+// CommitAuthorEmail email used for commits created by the server when no author is given
+const CommitAuthorEmail string = "gitbox@localhost"
+
+// BlobSniffSize number of bytes at the start of a file used to detect its content type
+const BlobSniffSize int = 8000
+
+// MaxJSONBlobSize max size of a file which can be returned base64 encoded in JSON
+const MaxJSONBlobSize int64 = 1 << 20
+
+// MaxPatchSize max size of a unified patch returned in JSON, larger patches are truncated
+const MaxPatchSize int64 = 1 << 20
+
+// MaxCompareCommits max commits listed when comparing two refs
+const MaxCompareCommits int = 250
+
+// PerPageRefCount default branches or tags returned in a single page
+const PerPageRefCount int64 = 30
+
+// MaxPerPageRefCount max branches or tags which can be requested in a single page
+const MaxPerPageRefCount int64 = 100
+
+// SearchResultCount default number of matches returned by /search
+const SearchResultCount int64 = 100
+
+// MaxSearchResultCount max number of matches which can be asked on /search
+const MaxSearchResultCount int64 = 1000
+
+// MaxSearchContext max lines of context which can be asked around each match on /search
+const MaxSearchContext int = 10
 
-// GitLogFormat format in which the git log is output
-const GitLogFormat string = `--pretty=format:{"commit": "%H","subject": "%s", "author": {"name": "%aN", "email": "%aE", "date": "%ad"},"commiter": {"name": "%cN", "email": "%cE", "date": "%cd"}}` + CommitSeparator
+// StatsHotFilesCount number of most frequently changed files returned by /stats
+const StatsHotFilesCount int = 10
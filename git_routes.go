@@ -0,0 +1,848 @@
+package main
+
+import (
+	"bufio"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"gitbox/config"
+	"gitbox/hub"
+	"gitbox/models"
+	"gitbox/server"
+	"gitbox/utils"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ContentsUpdateRequest structure of a single file update request, the file is deleted when delete is set
+type ContentsUpdateRequest struct {
+	Content  string        `json:"content"`
+	Encoding string        `json:"encoding"`
+	Delete   bool          `json:"delete"`
+	Message  string        `json:"message" binding:"required"`
+	Author   *utils.Author `json:"author"`
+	OldSha   string        `json:"oldSha" binding:"required"`
+}
+
+// RefDeleteRequest structure of a branch or tag delete request
+type RefDeleteRequest struct {
+	OldSha string `json:"oldSha" binding:"required"`
+}
+
+// getRepoBundle stream a git bundle of all refs, a single ref or a since..until range given in ref query
+func getRepoBundle(c *gin.Context) {
+	repoName := c.Params.ByName("repo")
+
+	revs, err := utils.GetBundleRevs(repoName, c.Query("ref"))
+
+	switch {
+	case errors.Is(err, utils.ErrEmptyRepo), errors.Is(err, utils.ErrEmptyBundleRange):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status": false,
+			"error":  err.Error(),
+		})
+		return
+	case errors.Is(err, utils.ErrRefNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"status": false,
+			"error":  err.Error(),
+		})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status": false,
+			"error":  err.Error(),
+		})
+		return
+	}
+
+	bundle, err := utils.OpenRepoBundle(repoName, revs)
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status": false,
+			"error":  err.Error(),
+		})
+		return
+	}
+
+	defer func() {
+		if err := bundle.Close(); err != nil {
+			log.Printf("unable to create bundle for %s: %v", repoName, err)
+		}
+	}()
+
+	c.DataFromReader(http.StatusOK, -1, "application/x-git-bundle", bundle, map[string]string{
+		"Content-Disposition": fmt.Sprintf(`attachment; filename="%s.bundle"`, repoName),
+	})
+}
+
+// getRepoTree list the directory at a path for the ref, refAndPath is "<ref>/<path>"
+func getRepoTree(c *gin.Context, refAndPath string) {
+	repoName := c.Params.ByName("repo")
+
+	refPath, err := utils.ResolveRefPath(repoName, refAndPath)
+
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status": false,
+			"error":  err.Error(),
+		})
+		return
+	}
+
+	entries, err := utils.GetTreeEntries(repoName, refPath)
+
+	switch {
+	case errors.Is(err, utils.ErrPathNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"status": false,
+			"error":  err.Error(),
+		})
+	case errors.Is(err, utils.ErrNotADirectory):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status": false,
+			"error":  err.Error(),
+		})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status": false,
+			"error":  err.Error(),
+		})
+	default:
+		c.JSON(http.StatusOK, gin.H{
+			"status":  true,
+			"ref":     refPath.Ref,
+			"commit":  refPath.Commit,
+			"path":    refPath.Path,
+			"entries": entries,
+		})
+	}
+}
+
+// getRepoRawFile stream the file at a path for the ref, with format=json query
+// the content is returned base64 encoded in JSON instead
+func getRepoRawFile(c *gin.Context, refAndPath string) {
+	repoName := c.Params.ByName("repo")
+
+	refPath, err := utils.ResolveRefPath(repoName, refAndPath)
+
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status": false,
+			"error":  err.Error(),
+		})
+		return
+	}
+
+	blobInfo, err := utils.GetBlobInfo(repoName, refPath)
+
+	switch {
+	case errors.Is(err, utils.ErrPathNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"status": false,
+			"error":  err.Error(),
+		})
+		return
+	case errors.Is(err, utils.ErrNotAFile):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status": false,
+			"error":  err.Error(),
+		})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status": false,
+			"error":  err.Error(),
+		})
+		return
+	}
+
+	etag := fmt.Sprintf(`"%s"`, blobInfo.Sha)
+
+	// a 304 has to carry the same validators, and the ref in the path can move, so always revalidate
+	c.Header("ETag", etag)
+	c.Header("Cache-Control", "no-cache")
+
+	if c.GetHeader("If-None-Match") == etag {
+		c.Status(http.StatusNotModified)
+		return
+	}
+
+	isJSON := c.Query("format") == "json"
+
+	if isJSON && blobInfo.Size > config.MaxJSONBlobSize {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status": false,
+			"error":  fmt.Sprintf("file is larger than %d bytes, fetch it without format=json", config.MaxJSONBlobSize),
+		})
+		return
+	}
+
+	blob, err := utils.OpenBlob(repoName, blobInfo.Sha)
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status": false,
+			"error":  err.Error(),
+		})
+		return
+	}
+
+	defer func() {
+		if err := blob.Close(); err != nil {
+			log.Printf("unable to read blob %s of %s: %v", blobInfo.Sha, repoName, err)
+		}
+	}()
+
+	blobReader := bufio.NewReaderSize(blob, config.BlobSniffSize)
+	sniff, _ := blobReader.Peek(config.BlobSniffSize)
+	contentType, isBinary := utils.DetectBlobContentType(sniff)
+
+	if isJSON {
+		content, err := ioutil.ReadAll(blobReader)
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status": false,
+				"error":  err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"status":      true,
+			"ref":         refPath.Ref,
+			"commit":      refPath.Commit,
+			"file":        blobInfo,
+			"contentType": contentType,
+			"binary":      isBinary,
+			"encoding":    "base64",
+			"content":     base64.StdEncoding.EncodeToString(content),
+		})
+
+		return
+	}
+
+	c.DataFromReader(http.StatusOK, blobInfo.Size, contentType, blobReader, map[string]string{
+		"X-Content-Type-Options": "nosniff",
+	})
+}
+
+// getRepoCommit single commit with its full message, parents and changed files,
+// the unified patch is included with patch=true query
+func getRepoCommit(c *gin.Context, rev string) {
+	repoName := c.Params.ByName("repo")
+	withPatch, _ := strconv.ParseBool(c.DefaultQuery("patch", "false"))
+
+	commit, err := utils.GetCommitDetail(repoName, rev, withPatch)
+
+	switch {
+	case errors.Is(err, utils.ErrRefNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"status": false,
+			"error":  err.Error(),
+		})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status": false,
+			"error":  err.Error(),
+		})
+	default:
+		c.JSON(http.StatusOK, gin.H{
+			"status": true,
+			"commit": commit,
+		})
+	}
+}
+
+// getRepoCompare compare two refs given as "<base>...<head>", the unified patch
+// is included with patch=true query
+func getRepoCompare(c *gin.Context, compareRange string) {
+	repoName := c.Params.ByName("repo")
+	withPatch, _ := strconv.ParseBool(c.DefaultQuery("patch", "false"))
+
+	baseRev, headRev, err := utils.ParseCompareRange(compareRange)
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status": false,
+			"error":  err.Error(),
+		})
+		return
+	}
+
+	comparison, err := utils.CompareCommits(repoName, baseRev, headRev, withPatch)
+
+	switch {
+	case errors.Is(err, utils.ErrRefNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"status": false,
+			"error":  err.Error(),
+		})
+	case errors.Is(err, utils.ErrNoMergeBase):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status": false,
+			"error":  err.Error(),
+		})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status": false,
+			"error":  err.Error(),
+		})
+	default:
+		c.JSON(http.StatusOK, gin.H{
+			"status":     true,
+			"comparison": comparison,
+		})
+	}
+}
+
+// getRefsPage page and per_page query of a branches or tags listing
+func getRefsPage(c *gin.Context) (int64, int64) {
+	pageNum, err := strconv.ParseInt(c.DefaultQuery("page", "0"), 10, 64)
+
+	if err != nil || pageNum < 0 {
+		pageNum = 0
+	}
+
+	return pageNum, utils.ParsePerPage(c.Query("per_page"), config.PerPageRefCount, config.MaxPerPageRefCount)
+}
+
+// getRepoBranches list branches with the commit each points to
+func getRepoBranches(c *gin.Context) {
+	repoName := c.Params.ByName("repo")
+	pageNum, perPage := getRefsPage(c)
+
+	branches, total, err := utils.ListBranches(repoName, pageNum, perPage)
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status": false,
+			"error":  err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":   true,
+		"branches": branches,
+		"page":     pageNum,
+		"perPage":  perPage,
+		"total":    total,
+	})
+}
+
+// getRepoTags list tags with the commit each points to
+func getRepoTags(c *gin.Context) {
+	repoName := c.Params.ByName("repo")
+	pageNum, perPage := getRefsPage(c)
+
+	tags, total, err := utils.ListTags(repoName, pageNum, perPage)
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status": false,
+			"error":  err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  true,
+		"tags":    tags,
+		"page":    pageNum,
+		"perPage": perPage,
+		"total":   total,
+	})
+}
+
+// getRepoBlame blame the file at a path for the ref, refAndPath is "<ref>/<path>",
+// start and end query restrict it to a range of lines
+func getRepoBlame(c *gin.Context, refAndPath string) {
+	repoName := c.Params.ByName("repo")
+
+	refPath, err := utils.ResolveRefPath(repoName, refAndPath)
+
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status": false,
+			"error":  err.Error(),
+		})
+		return
+	}
+
+	startLine, startErr := strconv.Atoi(c.DefaultQuery("start", "0"))
+	endLine, endErr := strconv.Atoi(c.DefaultQuery("end", "0"))
+
+	if startErr != nil || endErr != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status": false,
+			"error":  utils.ErrInvalidLineRange.Error(),
+		})
+		return
+	}
+
+	ranges, err := utils.GetBlame(repoName, refPath, startLine, endLine)
+
+	switch {
+	case errors.Is(err, utils.ErrPathNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"status": false,
+			"error":  err.Error(),
+		})
+	case errors.Is(err, utils.ErrNotAFile), errors.Is(err, utils.ErrInvalidLineRange):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status": false,
+			"error":  err.Error(),
+		})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status": false,
+			"error":  err.Error(),
+		})
+	default:
+		c.JSON(http.StatusOK, gin.H{
+			"status": true,
+			"ref":    refPath.Ref,
+			"commit": refPath.Commit,
+			"path":   refPath.Path,
+			"ranges": ranges,
+		})
+	}
+}
+
+// getRepoArchive stream a tar.gz or zip archive of the ref, archiveName is "<ref>.tar.gz" or "<ref>.zip",
+// path query limits it to a directory
+func getRepoArchive(c *gin.Context, archiveName string) {
+	repoName := c.Params.ByName("repo")
+
+	archive, err := utils.GetRepoArchive(repoName, archiveName, c.Query("path"))
+
+	switch {
+	case errors.Is(err, utils.ErrRefNotFound), errors.Is(err, utils.ErrPathNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"status": false,
+			"error":  err.Error(),
+		})
+		return
+	case errors.Is(err, utils.ErrUnknownArchiveFormat), errors.Is(err, utils.ErrNotADirectory):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status": false,
+			"error":  err.Error(),
+		})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status": false,
+			"error":  err.Error(),
+		})
+		return
+	}
+
+	archiveReader, err := utils.OpenRepoArchive(repoName, archive)
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status": false,
+			"error":  err.Error(),
+		})
+		return
+	}
+
+	defer func() {
+		if err := archiveReader.Close(); err != nil {
+			log.Printf("unable to create archive of %s for %s: %v", archive.Commit, repoName, err)
+		}
+	}()
+
+	// a branch or tag can move, only an archive asked by commit sha is cached
+	if archive.IsImmutable() {
+		server.HdrCacheForever(c.Writer)
+	} else {
+		server.HdrNocache(c.Writer)
+	}
+
+	c.DataFromReader(http.StatusOK, -1, archive.Format.ContentType, archiveReader, map[string]string{
+		"Content-Disposition": fmt.Sprintf(`attachment; filename="%s%s"`, archive.Prefix, archive.Format.Extension),
+	})
+}
+
+// getRepoLog commits log of HEAD or the ref query, filtered by path, author, committer,
+// since, until, grep, first_parent and no_merges queries, the next page is asked with
+// the after query cursor given in the Link header
+func getRepoLog(c *gin.Context) {
+	repoName := c.Params.ByName("repo")
+	pageNum, err := strconv.ParseInt(c.DefaultQuery("page", "0"), 10, 32)
+
+	if err != nil || pageNum < 0 {
+		pageNum = 0
+	}
+
+	perPage := utils.ParsePerPage(c.Query("per_page"), config.PerPageCommitCount, config.MaxPerPageCommitCount)
+	firstParent, _ := strconv.ParseBool(c.DefaultQuery("first_parent", "false"))
+	noMerges, _ := strconv.ParseBool(c.DefaultQuery("no_merges", "false"))
+
+	commitsLog, err := utils.GetCommitsLog(repoName, utils.LogOptions{
+		Ref:         c.Query("ref"),
+		Path:        c.Query("path"),
+		Author:      c.Query("author"),
+		Committer:   c.Query("committer"),
+		Since:       c.Query("since"),
+		Until:       c.Query("until"),
+		Grep:        c.Query("grep"),
+		FirstParent: firstParent,
+		NoMerges:    noMerges,
+		After:       c.Query("after"),
+		Page:        pageNum,
+		PerPage:     perPage,
+	})
+
+	switch {
+	case errors.Is(err, utils.ErrEmptyRepo):
+		c.JSON(http.StatusOK, gin.H{
+			"status":     true,
+			"logs":       []utils.CommitItem{},
+			"head":       "",
+			"nextCursor": "",
+			"perPage":    perPage,
+		})
+		return
+	case errors.Is(err, utils.ErrRefNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"status": false,
+			"error":  err.Error(),
+		})
+		return
+	case errors.Is(err, utils.ErrPathNotFound), errors.Is(err, utils.ErrInvalidCursor):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status": false,
+			"error":  err.Error(),
+		})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status": false,
+			"error":  err.Error(),
+		})
+		return
+	}
+
+	if commitsLog.NextCursor != "" {
+		c.Header("Link", fmt.Sprintf(`<%s>; rel="next"`, getNextPageURL(c, []string{commitsLog.Head}, commitsLog.NextCursor, perPage)))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":     true,
+		"logs":       commitsLog.Commits,
+		"head":       commitsLog.Head,
+		"nextCursor": commitsLog.NextCursor,
+		"perPage":    perPage,
+	})
+}
+
+// getNextPageURL url of the next log or graph page, pinned to the heads the walk
+// started from so commits pushed in between do not shift the pages
+func getNextPageURL(c *gin.Context, heads []string, cursor string, perPage int64) string {
+	nextURL := *c.Request.URL
+	query := nextURL.Query()
+
+	query.Del("page")
+	query["ref"] = heads
+	query.Set("after", cursor)
+	query.Set("per_page", strconv.FormatInt(perPage, 10))
+
+	nextURL.RawQuery = query.Encode()
+
+	return nextURL.RequestURI()
+}
+
+// getRepoGraph commits graph of the refs in ref queries or all branches, paginated
+// like the log with per_page and after queries
+func getRepoGraph(c *gin.Context) {
+	repoName := c.Params.ByName("repo")
+	perPage := utils.ParsePerPage(c.Query("per_page"), config.PerPageCommitCount, config.MaxPerPageCommitCount)
+
+	graph, err := utils.GetCommitsGraph(repoName, c.QueryArray("ref"), c.Query("after"), perPage)
+
+	switch {
+	case errors.Is(err, utils.ErrRefNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"status": false,
+			"error":  err.Error(),
+		})
+		return
+	case errors.Is(err, utils.ErrInvalidCursor):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status": false,
+			"error":  err.Error(),
+		})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status": false,
+			"error":  err.Error(),
+		})
+		return
+	}
+
+	if graph.NextCursor != "" {
+		c.Header("Link", fmt.Sprintf(`<%s>; rel="next"`, getNextPageURL(c, graph.Heads, graph.NextCursor, perPage)))
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":     true,
+		"commits":    graph.Commits,
+		"heads":      graph.Heads,
+		"nextCursor": graph.NextCursor,
+		"perPage":    perPage,
+	})
+}
+
+// getRepoSearch search files at HEAD or the ref query, q is a fixed string unless regex=true,
+// ignore_case, path globs, context lines and max_results can be given as queries
+func getRepoSearch(c *gin.Context) {
+	repoName := c.Params.ByName("repo")
+	regex, _ := strconv.ParseBool(c.DefaultQuery("regex", "false"))
+	ignoreCase, _ := strconv.ParseBool(c.DefaultQuery("ignore_case", "false"))
+	context, err := strconv.Atoi(c.DefaultQuery("context", "0"))
+
+	if err != nil || context < 0 {
+		context = 0
+	}
+
+	if context > config.MaxSearchContext {
+		context = config.MaxSearchContext
+	}
+
+	results, err := utils.SearchRepo(repoName, utils.SearchOptions{
+		Query:      c.Query("q"),
+		Ref:        c.Query("ref"),
+		Regex:      regex,
+		IgnoreCase: ignoreCase,
+		Paths:      c.QueryArray("path"),
+		Context:    context,
+		MaxResults: utils.ParsePerPage(c.Query("max_results"), config.SearchResultCount, config.MaxSearchResultCount),
+	})
+
+	switch {
+	case errors.Is(err, utils.ErrRefNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"status": false,
+			"error":  err.Error(),
+		})
+	case errors.Is(err, utils.ErrInvalidSearchQuery), errors.Is(err, utils.ErrPathNotFound):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status": false,
+			"error":  err.Error(),
+		})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status": false,
+			"error":  err.Error(),
+		})
+	default:
+		c.JSON(http.StatusOK, gin.H{
+			"status":    true,
+			"ref":       results.Ref,
+			"commit":    results.Commit,
+			"results":   results.Results,
+			"truncated": results.Truncated,
+		})
+	}
+}
+
+// getRepoStats contributors, weekly commit activity and most changed files of HEAD history
+func getRepoStats(c *gin.Context) {
+	repoName := c.Params.ByName("repo")
+
+	stats, err := utils.GetRepoStats(repoName)
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status": false,
+			"error":  err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": true,
+		"stats":  stats,
+	})
+}
+
+// commitRepoFiles create the commit, move its branch and let websocket clients know like a push would
+func commitRepoFiles(c *gin.Context, repoName string, commit *utils.NewCommit) {
+	refEvent, err := utils.CommitFiles(repoName, commit)
+
+	switch {
+	case errors.Is(err, utils.ErrRefNotFound), errors.Is(err, utils.ErrPathNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": err.Error(),
+		})
+		return
+	case errors.Is(err, utils.ErrRefChanged):
+		c.JSON(http.StatusConflict, gin.H{
+			"error": err.Error(),
+		})
+		return
+	case errors.Is(err, utils.ErrInvalidCommit), errors.Is(err, utils.ErrInvalidBranchName), errors.Is(err, utils.ErrNothingToCommit),
+		errors.Is(err, utils.ErrNotAFile), errors.Is(err, utils.ErrNotADirectory):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	hub.SuperHubInstance.SendEventToRepo(repoName, refEvent.Bytes())
+
+	c.JSON(http.StatusCreated, gin.H{
+		"status": true,
+		"branch": commit.Branch,
+		"commit": refEvent.NewSha,
+		"oldSha": refEvent.OldSha,
+	})
+}
+
+// putRepoContents write or delete a single file on a branch, branchAndPath is "<branch>/<path>"
+func putRepoContents(c *gin.Context, branchAndPath string) {
+	repoName := c.Params.ByName("repo")
+
+	var request ContentsUpdateRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   err.Error(),
+			"message": "Only JSON requests are allowed",
+		})
+		return
+	}
+
+	branch, filePath, err := utils.ResolveBranchPath(repoName, branchAndPath)
+
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "branch not found",
+		})
+		return
+	}
+
+	commitRepoFiles(c, repoName, &utils.NewCommit{
+		Branch:  branch,
+		OldSha:  request.OldSha,
+		Message: request.Message,
+		Author:  request.Author,
+		Files: []utils.CommitFile{{
+			Path:     filePath,
+			Content:  request.Content,
+			Encoding: request.Encoding,
+			Delete:   request.Delete,
+		}},
+	})
+}
+
+// postRepoCommit create a commit changing multiple files on a branch
+func postRepoCommit(c *gin.Context) {
+	repoName := c.Params.ByName("repo")
+
+	var request utils.NewCommit
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   err.Error(),
+			"message": "Only JSON requests are allowed",
+		})
+		return
+	}
+
+	commitRepoFiles(c, repoName, &request)
+}
+
+// respondRefEvent respond to a branch or tag create or delete and let websocket clients know like a push would
+func respondRefEvent(c *gin.Context, repoName string, refEvent *models.MetadataInfo, err error) {
+	switch {
+	case errors.Is(err, utils.ErrRefNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": err.Error(),
+		})
+		return
+	case errors.Is(err, utils.ErrRefExists), errors.Is(err, utils.ErrRefChanged):
+		c.JSON(http.StatusConflict, gin.H{
+			"error": err.Error(),
+		})
+		return
+	case errors.Is(err, utils.ErrInvalidBranchName), errors.Is(err, utils.ErrInvalidTagName),
+		errors.Is(err, utils.ErrInvalidOldSha), errors.Is(err, utils.ErrDeleteDefaultBranch):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	hub.SuperHubInstance.SendEventToRepo(repoName, refEvent.Bytes())
+
+	statusCode := http.StatusOK
+	if refEvent.Type == models.MetaInfoType_Create {
+		statusCode = http.StatusCreated
+	}
+
+	c.JSON(statusCode, gin.H{
+		"status": true,
+		"ref":    refEvent.Ref,
+		"oldSha": refEvent.OldSha,
+		"newSha": refEvent.NewSha,
+	})
+}
+
+// createRepoRef create a branch or tag, createRef is utils.CreateBranch or utils.CreateTag
+func createRepoRef(c *gin.Context, createRef func(string, *utils.NewRef) (*models.MetadataInfo, error)) {
+	repoName := c.Params.ByName("repo")
+
+	var request utils.NewRef
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   err.Error(),
+			"message": "Only JSON requests are allowed",
+		})
+		return
+	}
+
+	refEvent, err := createRef(repoName, &request)
+
+	respondRefEvent(c, repoName, refEvent, err)
+}
+
+// deleteRepoRef delete a branch or tag, deleteRef is utils.DeleteBranch or utils.DeleteTag
+func deleteRepoRef(c *gin.Context, name string, deleteRef func(string, string, string) (*models.MetadataInfo, error)) {
+	repoName := c.Params.ByName("repo")
+
+	var request RefDeleteRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   err.Error(),
+			"message": "Only JSON requests are allowed",
+		})
+		return
+	}
+
+	refEvent, err := deleteRef(repoName, name, request.OldSha)
+
+	respondRefEvent(c, repoName, refEvent, err)
+}
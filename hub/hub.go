@@ -1,6 +1,7 @@
 package hub
 
 import (
+	"sync"
 	"time"
 
 	"github.com/gorilla/websocket"
@@ -9,12 +10,84 @@ import (
 // SuperHub keeps track of all repoId and there Hubs
 type SuperHub map[string]*SingleHub
 
+// superHubLock guards concurrent access to SuperHubInstance
+var superHubLock sync.RWMutex
+
 // SendEventToRepo to send data to the repo channel
 func (sh SuperHub) SendEventToRepo(repoName string, data []byte) {
+	superHubLock.RLock()
 	channel, ok := sh[repoName]
+	superHubLock.RUnlock()
 
 	if ok {
-		channel.Broadcast <- data
+		select {
+		case channel.Broadcast <- data:
+		case <-channel.Done:
+		}
+	}
+}
+
+// GetOrCreateHub return the hub for repo, creating and starting one if needed
+func (sh SuperHub) GetOrCreateHub(repoName string) *SingleHub {
+	superHubLock.Lock()
+	defer superHubLock.Unlock()
+
+	if _, ok := sh[repoName]; !ok {
+		sh[repoName] = CreateNewHub(repoName)
+		go sh[repoName].Run()
+	}
+
+	return sh[repoName]
+}
+
+// RemoveHub send the last event to the repo hub, disconnect its clients and stop it
+func (sh SuperHub) RemoveHub(repoName string, data []byte) {
+	superHubLock.Lock()
+	channel, ok := sh[repoName]
+	delete(sh, repoName)
+	superHubLock.Unlock()
+
+	if !ok {
+		return
+	}
+
+	if data != nil {
+		select {
+		case channel.Broadcast <- data:
+		case <-channel.Done:
+		}
+	}
+
+	channel.Stop()
+}
+
+// RenameHub move the hub to the new repo name so connected clients stay subscribed,
+// data is sent to them once the hub is moved
+func (sh SuperHub) RenameHub(oldRepoName string, newRepoName string, data []byte) {
+	superHubLock.Lock()
+	channel, ok := sh[oldRepoName]
+	staleChannel, staleOk := sh[newRepoName]
+
+	delete(sh, oldRepoName)
+
+	if ok {
+		channel.RepoName = newRepoName
+		sh[newRepoName] = channel
+	} else {
+		delete(sh, newRepoName)
+	}
+	superHubLock.Unlock()
+
+	// clients waiting on the new name before the repo existed are dropped
+	if staleOk {
+		staleChannel.Stop()
+	}
+
+	if ok && data != nil {
+		select {
+		case channel.Broadcast <- data:
+		case <-channel.Done:
+		}
 	}
 }
 
@@ -34,6 +107,12 @@ type SingleHub struct {
 
 	// Unregister requests from clients.
 	Unregister chan *Client
+
+	// Shutdown requests to disconnect all clients and stop the hub.
+	Shutdown chan bool
+
+	// Done is closed once the hub has stopped running.
+	Done chan bool
 }
 
 // Run Start the hub to listen to events on it
@@ -56,10 +135,28 @@ func (h *SingleHub) Run() {
 					delete(h.Clients, client)
 				}
 			}
+		case <-h.Shutdown:
+			for client := range h.Clients {
+				close(client.Send)
+				delete(h.Clients, client)
+			}
+
+			close(h.Done)
+
+			return
 		}
 	}
 }
 
+// Stop disconnect all clients of the hub and wait for it to stop running
+func (h *SingleHub) Stop() {
+	select {
+	case h.Shutdown <- true:
+		<-h.Done
+	case <-h.Done:
+	}
+}
+
 // Client is a middleman between the websocket connection and the hub.
 type Client struct {
 	Hub *SingleHub
@@ -75,7 +172,10 @@ func (client *Client) Write() {
 	ticker := time.NewTicker(pingPeriod)
 
 	defer func() {
-		client.Hub.Unregister <- client
+		select {
+		case client.Hub.Unregister <- client:
+		case <-client.Hub.Done:
+		}
 
 		ticker.Stop()
 
@@ -147,6 +247,8 @@ func CreateNewHub(repoName string) *SingleHub {
 		Broadcast:  make(chan []byte),
 		Register:   make(chan *Client),
 		Unregister: make(chan *Client),
+		Shutdown:   make(chan bool),
+		Done:       make(chan bool),
 		Clients:    make(map[*Client]bool),
 	}
 }
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"gitbox/config"
@@ -9,7 +10,7 @@ import (
 	"gitbox/utils"
 	"log"
 	"net/http"
-	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"github.com/gorilla/websocket"
@@ -17,19 +18,52 @@ import (
 
 // RepoCreateRequest structure of request
 type RepoCreateRequest struct {
-	RepoName string `json:"name" binding:"required"`
+	RepoName      string              `json:"name" binding:"required"`
+	InitialBranch string              `json:"initialBranch"`
+	Template      *utils.RepoTemplate `json:"template"`
+	utils.RepoMetadataUpdate
 }
 
 // RepoCreateResponse structure of response
 type RepoCreateResponse struct {
-	Status   bool   `json:"status"`
-	RepoName string `json:"repoName"`
+	Status   bool                `json:"status"`
+	RepoName string              `json:"repoName"`
+	Commit   string              `json:"commit,omitempty"`
+	Metadata *utils.RepoMetadata `json:"metadata"`
+}
+
+// invalidRepoNameMessage error shown when a repo name fails utils.IsRepoNameValid
+const invalidRepoNameMessage = "repo name can only contain alpha numeric characters and '-' or '_', optionally prefixed with an owner as 'owner/repo'"
+
+// setParam overwrite the value of a url param, adding it if the route has no such param
+func setParam(c *gin.Context, key string, value string) {
+	for i, param := range c.Params {
+		if param.Key == key {
+			c.Params[i].Value = value
+			return
+		}
+	}
+
+	c.Params = append(c.Params, gin.Param{Key: key, Value: value})
+}
+
+// resolveRepoNamespace middleware which moves the repo part of owner/repo names from the
+// action param into the repoParam, so handlers always see the full repo name
+func resolveRepoNamespace(repoParam string, allowNewNamespace bool) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		repoName, action := utils.ResolveRepoName(c.Params.ByName(repoParam), c.Params.ByName("action"), allowNewNamespace)
+
+		setParam(c, repoParam, repoName)
+		setParam(c, "action", action)
+
+		c.Next()
+	}
 }
 
 // addGitRoutes Setup all git operation related routes
 //nolint:funlen
 func addGitRoutes(gitOps *gin.RouterGroup) {
-	gitOps.Use(func(c *gin.Context) {
+	gitOps.Use(resolveRepoNamespace("repo", false), func(c *gin.Context) {
 		repoName := c.Params.ByName("repo")
 
 		if repoNameValid := utils.IsRepoNameValid(repoName); !repoNameValid {
@@ -41,9 +75,22 @@ func addGitRoutes(gitOps *gin.RouterGroup) {
 			return
 		}
 
-		exists := utils.CheckRepoExists(repoName)
+		if !utils.RepoExists(repoName) {
+			// send git clients of a recently renamed repo to its new name
+			if newRepoName, ok := utils.GetRepoRedirect(repoName); ok {
+				redirectURL := *c.Request.URL
+				redirectURL.Path = strings.Replace(
+					redirectURL.Path,
+					strings.Replace(gitOps.BasePath(), ":repo", repoName, 1),
+					strings.Replace(gitOps.BasePath(), ":repo", newRepoName, 1),
+					1,
+				)
+
+				c.Redirect(http.StatusTemporaryRedirect, redirectURL.String())
+				c.Abort()
+				return
+			}
 
-		if exists == nil {
 			c.JSON(http.StatusNotFound, gin.H{
 				"status": false,
 				"error":  "repo not found",
@@ -58,33 +105,67 @@ func addGitRoutes(gitOps *gin.RouterGroup) {
 	gitOps.Any("/*action", func(c *gin.Context) {
 		action := c.Param("action")
 
-		switch action {
-		case "/":
+		switch {
+		case action == "/":
 			c.JSON(http.StatusOK, gin.H{
 				"status": true,
 			})
-		case "/log":
-			repoName := c.Params.ByName("repo")
-			pageNum, err := strconv.ParseInt(c.DefaultQuery("page", "0"), 10, 32)
+		case action == "/log":
+			getRepoLog(c)
 
-			if err != nil || pageNum < 0 {
-				pageNum = 0
-			}
+		case strings.HasPrefix(action, "/contents/") && c.Request.Method == http.MethodPut:
+			putRepoContents(c, strings.TrimPrefix(action, "/contents/"))
 
-			logsJSON, err := utils.GetCommitsLog(repoName, pageNum)
+		case action == "/commits" && c.Request.Method == http.MethodPost:
+			postRepoCommit(c)
 
-			if err != nil {
-				c.JSON(http.StatusInternalServerError, gin.H{
-					"status": false,
-					"error":  err.Error(),
-				})
-				return
-			}
+		case action == "/search":
+			getRepoSearch(c)
 
-			c.JSON(http.StatusOK, gin.H{
-				"status": true,
-				"logs":   logsJSON,
-			})
+		case action == "/stats":
+			getRepoStats(c)
+
+		case action == "/graph":
+			getRepoGraph(c)
+
+		case action == "/bundle":
+			getRepoBundle(c)
+
+		case strings.HasPrefix(action, "/tree/"):
+			getRepoTree(c, strings.TrimPrefix(action, "/tree/"))
+
+		case strings.HasPrefix(action, "/raw/"):
+			getRepoRawFile(c, strings.TrimPrefix(action, "/raw/"))
+
+		case strings.HasPrefix(action, "/commit/"):
+			getRepoCommit(c, strings.TrimPrefix(action, "/commit/"))
+
+		case action == "/branches" && c.Request.Method == http.MethodPost:
+			createRepoRef(c, utils.CreateBranch)
+
+		case strings.HasPrefix(action, "/branches/") && c.Request.Method == http.MethodDelete:
+			deleteRepoRef(c, strings.TrimPrefix(action, "/branches/"), utils.DeleteBranch)
+
+		case action == "/tags" && c.Request.Method == http.MethodPost:
+			createRepoRef(c, utils.CreateTag)
+
+		case strings.HasPrefix(action, "/tags/") && c.Request.Method == http.MethodDelete:
+			deleteRepoRef(c, strings.TrimPrefix(action, "/tags/"), utils.DeleteTag)
+
+		case action == "/branches":
+			getRepoBranches(c)
+
+		case action == "/tags":
+			getRepoTags(c)
+
+		case strings.HasPrefix(action, "/blame/"):
+			getRepoBlame(c, strings.TrimPrefix(action, "/blame/"))
+
+		case strings.HasPrefix(action, "/archive/"):
+			getRepoArchive(c, strings.TrimPrefix(action, "/archive/"))
+
+		case strings.HasPrefix(action, "/compare/"):
+			getRepoCompare(c, strings.TrimPrefix(action, "/compare/"))
 
 		default:
 			server.GitOpsHandler(c)
@@ -94,14 +175,18 @@ func addGitRoutes(gitOps *gin.RouterGroup) {
 
 func addWebSocketRoutes(webSockets *gin.RouterGroup) {
 	webSockets.Any("/*action", func(c *gin.Context) {
-		repoName := c.Params.ByName("repo")
-		_ = c.Param("action")
+		repoName := utils.ResolveWebSocketRepoName(c.Params.ByName("repo"), c.Params.ByName("action"))
 
-		if _, ok := hub.SuperHubInstance[repoName]; !ok {
-			hub.SuperHubInstance[repoName] = hub.CreateNewHub(repoName)
-			go hub.SuperHubInstance[repoName].Run()
+		if !utils.IsRepoNameValid(repoName) {
+			c.JSON(http.StatusNotFound, gin.H{
+				"status": false,
+				"error":  "invalid repo name",
+			})
+			return
 		}
 
+		repoHub := hub.SuperHubInstance.GetOrCreateHub(repoName)
+
 		var upgrader websocket.Upgrader = websocket.Upgrader{
 			CheckOrigin: func(r *http.Request) bool {
 				return true
@@ -118,12 +203,18 @@ func addWebSocketRoutes(webSockets *gin.RouterGroup) {
 		}
 
 		client := &hub.Client{
-			Hub:  hub.SuperHubInstance[repoName],
+			Hub:  repoHub,
 			Conn: connection,
 			Send: make(chan []byte, 256),
 		}
 
-		client.Hub.Register <- client
+		select {
+		case client.Hub.Register <- client:
+		case <-client.Hub.Done:
+			// repo got deleted while the connection was being upgraded
+			_ = connection.Close()
+			return
+		}
 
 		// start a go routine which will send messages to this client when something comes on channel
 		go client.Write()
@@ -150,7 +241,28 @@ func SetupServer() *gin.Engine {
 
 		if repoNameValid := utils.IsRepoNameValid(request.RepoName); !repoNameValid {
 			c.JSON(http.StatusBadRequest, gin.H{
-				"error": "repo name can only contain alpha numeric characters and '-' or '_'",
+				"error": invalidRepoNameMessage,
+			})
+			return
+		}
+
+		if request.InitialBranch != "" && !utils.IsBranchNameValid(request.InitialBranch) {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": utils.ErrInvalidBranchName.Error(),
+			})
+			return
+		}
+
+		if err := request.RepoMetadataUpdate.Validate(request.RepoName); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		if err := request.Template.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
 			})
 			return
 		}
@@ -162,19 +274,50 @@ func SetupServer() *gin.Engine {
 			return
 		}
 
-		if err := utils.CreateNewRepo(request.RepoName); err != nil {
+		commitSha, err := utils.CreateNewRepoFromTemplate(request.RepoName, request.InitialBranch, request.Template)
+
+		switch {
+		case errors.Is(err, utils.ErrEmptyRepo):
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error": err.Error(),
+			})
+			return
+		case err != nil:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		metadata, err := utils.UpdateRepoMetadata(request.RepoName, &request.RepoMetadataUpdate)
+
+		if err != nil {
+			_ = utils.RemoveRepo(request.RepoName)
+
 			c.JSON(http.StatusInternalServerError, gin.H{
 				"error": err.Error(),
 			})
 			return
 		}
 
-		c.JSON(http.StatusOK, gin.H{
-			"status":   true,
-			"repoName": request.RepoName,
+		utils.RemoveRepoRedirect(request.RepoName)
+
+		c.JSON(http.StatusOK, RepoCreateResponse{
+			Status:   true,
+			RepoName: request.RepoName,
+			Commit:   commitSha,
+			Metadata: metadata,
 		})
 	})
 
+	router.GET("/repos", listRepos)
+
+	repoOps := router.Group("/repo/:name")
+	addRepoRoutes(repoOps)
+
+	trash := router.Group("/trash")
+	addTrashRoutes(trash)
+
 	gitOps := router.Group("/git/:repo")
 	addGitRoutes(gitOps)
 
@@ -187,8 +330,12 @@ func SetupServer() *gin.Engine {
 func main() {
 	flag.StringVar(&config.PORT, "port", "9090", "port on which to run the server. Default: 9090")
 	flag.StringVar(&config.REPO_BASE_DIR, "repos", "/tmp/repos", "directory where repos will be created. Default: /tmp/repos")
+	flag.DurationVar(&config.TRASH_RETENTION, "trash-retention", config.DefaultTrashRetention, "time for which deleted repos can be restored. Default: 168h")
+	flag.DurationVar(&config.RENAME_REDIRECT_TTL, "rename-redirect", 0, "time for which git requests to the old name of a renamed repo are redirected. Default: 0 (disabled)")
 	flag.Parse()
 
+	go purgeExpiredTrash(config.TrashPurgeInterval)
+
 	ginRouter := SetupServer()
 
 	if err := ginRouter.Run(fmt.Sprintf(":%s", config.PORT)); err != nil {
@@ -1,14 +1,29 @@
 package main_test
 
 import (
+	"archive/tar"
+	"archive/zip"
 	"bytes"
+	"compress/gzip"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	. "gitbox"
+	"gitbox/config"
+	"gitbox/hub"
+	"gitbox/models"
 	"gitbox/utils"
+	"io"
 	"io/ioutil"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
 	"testing"
 	"time"
 )
@@ -64,3 +79,2118 @@ func Test_RepoCreateEndpoint(t *testing.T) {
 	repoAbsolutePath := utils.GetRepoAbsolutePath(generateRepoName)
 	_ = utils.RemoveRepoAtPath(repoAbsolutePath)
 }
+
+func createTestRepo(t *testing.T, serverURL string, repoName string) {
+	requestBody, err := json.Marshal(map[string]string{
+		"name": repoName,
+	})
+
+	if err != nil {
+		t.Fatalf("error, %v", err)
+	}
+
+	response, err := http.Post(fmt.Sprintf("%s/repo", serverURL), "application/json", bytes.NewBuffer(requestBody))
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	defer response.Body.Close()
+
+	if response.StatusCode != 200 {
+		t.Fatalf("Expected status code 200, got %v", response.StatusCode)
+	}
+}
+
+// subscribeRepoEvents register a client on the hub of the repo and return the channel its events
+// are sent on, the hub registers it before any later event so none is missed
+func subscribeRepoEvents(t *testing.T, repoName string) chan []byte {
+	client := &hub.Client{
+		Hub:  hub.SuperHubInstance.GetOrCreateHub(repoName),
+		Send: make(chan []byte, 256),
+	}
+
+	select {
+	case client.Hub.Register <- client:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected client to be registered on hub of %s", repoName)
+	}
+
+	return client.Send
+}
+
+// readRepoEvent wait for the next event sent to the subscribed client and decode it
+func readRepoEvent(t *testing.T, events chan []byte, event interface{}) {
+	select {
+	case data, ok := <-events:
+		if !ok {
+			t.Fatalf("Expected event, got hub closed")
+		}
+
+		if err := json.Unmarshal(data, event); err != nil {
+			t.Fatalf("Expected JSON event, got error %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected event within 5 seconds")
+	}
+}
+
+func doJSONRequest(t *testing.T, method string, url string, body interface{}, result interface{}) int {
+	var requestBody io.Reader
+
+	if body != nil {
+		bodyBytes, err := json.Marshal(body)
+		if err != nil {
+			t.Fatalf("error, %v", err)
+		}
+
+		requestBody = bytes.NewBuffer(bodyBytes)
+	}
+
+	request, err := http.NewRequest(method, url, requestBody)
+	if err != nil {
+		t.Fatalf("error, %v", err)
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	defer response.Body.Close()
+
+	if result != nil {
+		if err := json.NewDecoder(response.Body).Decode(result); err != nil {
+			t.Fatalf("Body read error : %v", err)
+		}
+	}
+
+	return response.StatusCode
+}
+
+func Test_RepoDeleteAndRestoreEndpoint(t *testing.T) {
+	defer setupTestBaseDir(t)()
+
+	ts := httptest.NewServer(SetupServer())
+	defer ts.Close()
+
+	createTestRepo(t, ts.URL, "to-delete")
+
+	var deleteResponse struct {
+		Status bool            `json:"status"`
+		Trash  utils.TrashItem `json:"trash"`
+	}
+
+	if status := doJSONRequest(t, http.MethodDelete, ts.URL+"/repo/to-delete", nil, &deleteResponse); status != 200 {
+		t.Fatalf("Expected status code 200, got %v", status)
+	}
+
+	if utils.CheckRepoExists("to-delete") != nil {
+		t.Fatalf("Expected repo to be removed after delete")
+	}
+
+	if status := doJSONRequest(t, http.MethodDelete, ts.URL+"/repo/to-delete", nil, nil); status != 404 {
+		t.Fatalf("Expected status code 404 for deleted repo, got %v", status)
+	}
+
+	var listResponse struct {
+		Trash []utils.TrashItem `json:"trash"`
+	}
+
+	doJSONRequest(t, http.MethodGet, ts.URL+"/trash", nil, &listResponse)
+
+	if len(listResponse.Trash) != 1 || listResponse.Trash[0].RepoName != "to-delete" {
+		t.Fatalf("Expected deleted repo to be listed in trash, got %v", listResponse.Trash)
+	}
+
+	restoreURL := fmt.Sprintf("%s/trash/%s/restore", ts.URL, deleteResponse.Trash.ID)
+
+	if status := doJSONRequest(t, http.MethodPost, restoreURL, nil, nil); status != 200 {
+		t.Fatalf("Expected status code 200, got %v", status)
+	}
+
+	if utils.CheckRepoExists("to-delete") == nil {
+		t.Fatalf("Expected repo to exist after restore")
+	}
+
+	if status := doJSONRequest(t, http.MethodPost, restoreURL, nil, nil); status != 404 {
+		t.Fatalf("Expected status code 404 for restored trash item, got %v", status)
+	}
+}
+
+func setupTestBaseDir(t *testing.T) func() {
+	baseDir, err := ioutil.TempDir("", "gitbox-test")
+	if err != nil {
+		t.Fatalf("error, %v", err)
+	}
+
+	config.REPO_BASE_DIR = baseDir
+
+	return func() {
+		config.REPO_BASE_DIR = ""
+		_ = os.RemoveAll(baseDir)
+	}
+}
+
+// pushTestCommit commit the files in a temporary clone and push it to the repo branch
+func pushTestCommit(t *testing.T, repoName string, branch string, files map[string]string, message string) {
+	workDir, err := ioutil.TempDir("", "gitbox-work")
+	if err != nil {
+		t.Fatalf("error, %v", err)
+	}
+
+	defer os.RemoveAll(workDir)
+
+	gitCommand := func(args ...string) *exec.Cmd {
+		gitArgs := append([]string{"-c", "user.name=Test User", "-c", "user.email=test@example.com"}, args...)
+		command := exec.Command("git", gitArgs...)
+		command.Dir = workDir
+
+		return command
+	}
+
+	runGit := func(args ...string) {
+		if out, err := gitCommand(args...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v %s", args, err, out)
+		}
+	}
+
+	runGit("init", "-q")
+
+	// continue on top of the branch when it already exists
+	if err := gitCommand("fetch", "-q", utils.GetRepoAbsolutePath(repoName), "refs/heads/"+branch).Run(); err == nil {
+		runGit("checkout", "-q", "FETCH_HEAD")
+	}
+
+	// an empty content removes the file
+	for fileName, content := range files {
+		filePath := filepath.Join(workDir, fileName)
+
+		if content == "" {
+			_ = os.Remove(filePath)
+			continue
+		}
+
+		_ = os.MkdirAll(filepath.Dir(filePath), 0700)
+
+		if err := ioutil.WriteFile(filePath, []byte(content), 0600); err != nil {
+			t.Fatalf("error, %v", err)
+		}
+	}
+
+	runGit("add", "-A")
+	runGit("commit", "-q", "--allow-empty", "-m", message)
+	runGit("push", "-q", utils.GetRepoAbsolutePath(repoName), "HEAD:refs/heads/"+branch)
+}
+
+func Test_RepoListEndpoint(t *testing.T) {
+	defer setupTestBaseDir(t)()
+
+	ts := httptest.NewServer(SetupServer())
+	defer ts.Close()
+
+	createTestRepo(t, ts.URL, "list-b")
+	createTestRepo(t, ts.URL, "list-a")
+	pushTestCommit(t, "list-b", "master", map[string]string{"README.md": "hello"}, "initial commit")
+
+	var listResponse struct {
+		Repos []utils.RepoSummary `json:"repos"`
+		Total int                 `json:"total"`
+	}
+
+	if status := doJSONRequest(t, http.MethodGet, ts.URL+"/repos?sort=name", nil, &listResponse); status != 200 {
+		t.Fatalf("Expected status code 200, got %v", status)
+	}
+
+	if listResponse.Total != 2 || listResponse.Repos[0].Name != "list-a" || listResponse.Repos[1].Name != "list-b" {
+		t.Fatalf("Expected repos sorted by name, got %v", listResponse.Repos)
+	}
+
+	if listResponse.Repos[0].LastCommit != nil || listResponse.Repos[0].RefsCount != 0 {
+		t.Fatalf("Expected empty repo to have no commits, got %v", listResponse.Repos[0])
+	}
+
+	if listResponse.Repos[1].LastCommit == nil || listResponse.Repos[1].RefsCount != 1 || listResponse.Repos[1].DefaultBranch != "master" {
+		t.Fatalf("Expected pushed repo summary, got %v", listResponse.Repos[1])
+	}
+
+	doJSONRequest(t, http.MethodGet, ts.URL+"/repos?sort=name&order=desc&per_page=1&page=1", nil, &listResponse)
+
+	if listResponse.Total != 2 || len(listResponse.Repos) != 1 || listResponse.Repos[0].Name != "list-a" {
+		t.Fatalf("Expected second page to have only list-a, got %v", listResponse.Repos)
+	}
+
+	// a detached HEAD has no default branch, the repo is still listed along with the others
+	headSha, err := exec.Command("git", "-C", utils.GetRepoAbsolutePath("list-b"), "rev-parse", "HEAD").Output()
+	if err != nil {
+		t.Fatalf("error, %v", err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(utils.GetRepoAbsolutePath("list-b"), "HEAD"), headSha, 0600); err != nil {
+		t.Fatalf("error, %v", err)
+	}
+
+	if status := doJSONRequest(t, http.MethodGet, ts.URL+"/repos?sort=name", nil, &listResponse); status != 200 || listResponse.Total != 2 {
+		t.Fatalf("Expected status code 200 with a detached HEAD repo, got %v %v", status, listResponse)
+	}
+
+	if listResponse.Repos[0].Error != "" || listResponse.Repos[1].Name != "list-b" || listResponse.Repos[1].Error == "" {
+		t.Fatalf("Expected only list-b to carry an error, got %v", listResponse.Repos)
+	}
+
+	if status := doJSONRequest(t, http.MethodGet, ts.URL+"/repos?per_page=2&page=9223372036854775807", nil, &listResponse); status != 200 || len(listResponse.Repos) != 0 {
+		t.Fatalf("Expected huge page to be empty, got %v %v", status, listResponse.Repos)
+	}
+
+	if status := doJSONRequest(t, http.MethodGet, ts.URL+"/repos?sort=size", nil, nil); status != 400 {
+		t.Fatalf("Expected status code 400 for invalid sort, got %v", status)
+	}
+}
+
+func Test_RepoRenameEndpoint(t *testing.T) {
+	defer setupTestBaseDir(t)()
+
+	config.RENAME_REDIRECT_TTL = time.Minute
+	defer func() { config.RENAME_REDIRECT_TTL = 0 }()
+
+	ts := httptest.NewServer(SetupServer())
+	defer ts.Close()
+
+	createTestRepo(t, ts.URL, "old-name")
+	createTestRepo(t, ts.URL, "taken-name")
+
+	events := subscribeRepoEvents(t, "old-name")
+
+	if status := doJSONRequest(t, http.MethodPatch, ts.URL+"/repo/old-name", RepoUpdateRequest{RepoName: "taken-name"}, nil); status != 409 {
+		t.Fatalf("Expected status code 409 for existing repo name, got %v", status)
+	}
+
+	if status := doJSONRequest(t, http.MethodPatch, ts.URL+"/repo/old-name", RepoUpdateRequest{RepoName: "new-name"}, nil); status != 200 {
+		t.Fatalf("Expected status code 200, got %v", status)
+	}
+
+	var renameEvent models.RepoEvent
+
+	readRepoEvent(t, events, &renameEvent)
+
+	if renameEvent.Type != models.RepoEventType_Rename || renameEvent.Old != "old-name" || renameEvent.New != "new-name" {
+		t.Fatalf("Expected rename event, got %v", renameEvent)
+	}
+
+	if utils.CheckRepoExists("old-name") != nil || utils.CheckRepoExists("new-name") == nil {
+		t.Fatalf("Expected repo to be moved to the new name")
+	}
+
+	client := &http.Client{
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	response, err := client.Get(ts.URL + "/git/old-name/info/refs?service=git-upload-pack")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	response.Body.Close()
+
+	if response.StatusCode != http.StatusTemporaryRedirect || response.Header.Get("Location") != "/git/new-name/info/refs?service=git-upload-pack" {
+		t.Fatalf("Expected redirect to new name, got %v %v", response.StatusCode, response.Header.Get("Location"))
+	}
+
+	createTestRepo(t, ts.URL, "broken-metadata")
+
+	if err := ioutil.WriteFile(filepath.Join(utils.GetRepoAbsolutePath("broken-metadata"), "gitbox.json"), []byte("{"), 0644); err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	description := "renamed"
+
+	var renameResponse struct {
+		Status   bool   `json:"status"`
+		RepoName string `json:"repoName"`
+		Error    string `json:"error"`
+	}
+
+	status := doJSONRequest(t, http.MethodPatch, ts.URL+"/repo/broken-metadata",
+		RepoUpdateRequest{RepoName: "renamed-metadata", RepoMetadataUpdate: utils.RepoMetadataUpdate{Description: &description}}, &renameResponse)
+
+	if status != 200 || !renameResponse.Status || renameResponse.RepoName != "renamed-metadata" || renameResponse.Error == "" {
+		t.Fatalf("Expected rename to succeed and report the metadata error, got %v %v", status, renameResponse)
+	}
+}
+
+func Test_RepoForkEndpoint(t *testing.T) {
+	defer setupTestBaseDir(t)()
+
+	ts := httptest.NewServer(SetupServer())
+	defer ts.Close()
+
+	createTestRepo(t, ts.URL, "parent")
+	pushTestCommit(t, "parent", "master", map[string]string{"README.md": "hello"}, "initial commit")
+
+	if status := doJSONRequest(t, http.MethodPost, ts.URL+"/repo/parent/fork", RepoForkRequest{"child"}, nil); status != 200 {
+		t.Fatalf("Expected status code 200, got %v", status)
+	}
+
+	alternatesPath := filepath.Join(utils.GetRepoAbsolutePath("child"), "objects", "info", "alternates")
+	if _, err := os.Stat(alternatesPath); err != nil {
+		t.Fatalf("Expected fork to share objects through alternates, got %v", err)
+	}
+
+	if metadata, err := utils.GetRepoMetadata("child"); err != nil || metadata.Parent != "parent" {
+		t.Fatalf("Expected fork parent to be recorded in metadata, got %v %v", metadata, err)
+	}
+
+	var listResponse struct {
+		Repos []utils.RepoSummary `json:"repos"`
+	}
+
+	doJSONRequest(t, http.MethodGet, ts.URL+"/repos", nil, &listResponse)
+
+	if len(listResponse.Repos) != 2 || listResponse.Repos[1].Name != "parent" || len(listResponse.Repos[1].Forks) != 1 {
+		t.Fatalf("Expected parent to list its fork, got %v", listResponse.Repos)
+	}
+
+	if status := doJSONRequest(t, http.MethodDelete, ts.URL+"/repo/parent", nil, nil); status != 200 {
+		t.Fatalf("Expected status code 200, got %v", status)
+	}
+
+	if _, err := os.Stat(alternatesPath); !os.IsNotExist(err) {
+		t.Fatalf("Expected fork to stop borrowing objects from deleted parent")
+	}
+
+	if parent := utils.GetRepoParent("child"); parent != "" {
+		t.Fatalf("Expected detached fork to have no parent, got %q", parent)
+	}
+
+	fsck := exec.Command("git", "fsck", "--full")
+	fsck.Dir = utils.GetRepoAbsolutePath("child")
+
+	if out, err := fsck.CombinedOutput(); err != nil {
+		t.Fatalf("Expected fork to be intact after parent delete, got %v %s", err, out)
+	}
+}
+
+func uploadTestBundle(t *testing.T, url string, bundleContent []byte) int {
+	var body bytes.Buffer
+
+	writer := multipart.NewWriter(&body)
+	part, err := writer.CreateFormFile("bundle", "repo.bundle")
+
+	if err != nil {
+		t.Fatalf("error, %v", err)
+	}
+
+	_, _ = part.Write(bundleContent)
+	_ = writer.Close()
+
+	response, err := http.Post(url, writer.FormDataContentType(), &body)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	response.Body.Close()
+
+	return response.StatusCode
+}
+
+func Test_RepoImportEndpoint(t *testing.T) {
+	defer setupTestBaseDir(t)()
+
+	ts := httptest.NewServer(SetupServer())
+	defer ts.Close()
+
+	createTestRepo(t, ts.URL, "source")
+	pushTestCommit(t, "source", "master", map[string]string{"README.md": "hello"}, "initial commit")
+	pushTestCommit(t, "source", "feature", map[string]string{"feature.txt": "feature"}, "feature commit")
+
+	bundlePath := filepath.Join(config.REPO_BASE_DIR, "source.bundle")
+	bundleCommand := exec.Command("git", "bundle", "create", bundlePath, "--all")
+	bundleCommand.Dir = utils.GetRepoAbsolutePath("source")
+
+	if out, err := bundleCommand.CombinedOutput(); err != nil {
+		t.Fatalf("git bundle failed: %v %s", err, out)
+	}
+
+	bundleContent, err := ioutil.ReadFile(bundlePath)
+	if err != nil {
+		t.Fatalf("error, %v", err)
+	}
+
+	if status := uploadTestBundle(t, ts.URL+"/repo/imported/import", bundleContent); status != 200 {
+		t.Fatalf("Expected status code 200, got %v", status)
+	}
+
+	showRef := exec.Command("git", "show-ref", "--verify", "refs/heads/master", "refs/heads/feature")
+	showRef.Dir = utils.GetRepoAbsolutePath("imported")
+
+	if out, err := showRef.CombinedOutput(); err != nil {
+		t.Fatalf("Expected imported repo to have all refs, got %v %s", err, out)
+	}
+
+	// a bundle of HEAD alone lands on the default branch
+	headBundlePath := filepath.Join(config.REPO_BASE_DIR, "head.bundle")
+	headBundleCommand := exec.Command("git", "bundle", "create", headBundlePath, "HEAD")
+	headBundleCommand.Dir = utils.GetRepoAbsolutePath("source")
+
+	if out, err := headBundleCommand.CombinedOutput(); err != nil {
+		t.Fatalf("git bundle failed: %v %s", err, out)
+	}
+
+	headBundleContent, err := ioutil.ReadFile(headBundlePath)
+	if err != nil {
+		t.Fatalf("error, %v", err)
+	}
+
+	if status := uploadTestBundle(t, ts.URL+"/repo/head-only/import", headBundleContent); status != 200 {
+		t.Fatalf("Expected status code 200 for HEAD only bundle, got %v", status)
+	}
+
+	var logResponse struct {
+		Logs []utils.CommitItem `json:"logs"`
+	}
+
+	if status := doJSONRequest(t, http.MethodGet, ts.URL+"/git/head-only/log", nil, &logResponse); status != 200 || len(logResponse.Logs) != 1 {
+		t.Fatalf("Expected HEAD only bundle to be imported on the default branch, got %v %v", status, logResponse.Logs)
+	}
+
+	if status := uploadTestBundle(t, ts.URL+"/repo/imported/import", bundleContent); status != 409 {
+		t.Fatalf("Expected status code 409 for existing repo, got %v", status)
+	}
+
+	if status := uploadTestBundle(t, ts.URL+"/repo/broken/import", bundleContent[:len(bundleContent)/2]); status != 400 {
+		t.Fatalf("Expected status code 400 for truncated bundle, got %v", status)
+	}
+
+	if utils.CheckRepoExists("broken") != nil {
+		t.Fatalf("Expected repo to be removed after failed import")
+	}
+}
+
+func Test_RepoBundleEndpoint(t *testing.T) {
+	defer setupTestBaseDir(t)()
+
+	ts := httptest.NewServer(SetupServer())
+	defer ts.Close()
+
+	createTestRepo(t, ts.URL, "bundled")
+
+	if status := doJSONRequest(t, http.MethodGet, ts.URL+"/git/bundled/bundle", nil, nil); status != 400 {
+		t.Fatalf("Expected status code 400 for empty repo, got %v", status)
+	}
+
+	pushTestCommit(t, "bundled", "master", map[string]string{"README.md": "hello"}, "initial commit")
+	pushTestCommit(t, "bundled", "master", map[string]string{"README.md": "hello again"}, "second commit")
+
+	response, err := http.Get(ts.URL + "/git/bundled/bundle")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	bundleContent, err := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+
+	if err != nil || response.StatusCode != 200 || response.Header.Get("Content-Type") != "application/x-git-bundle" {
+		t.Fatalf("Expected bundle download, got %v %v", response.StatusCode, err)
+	}
+
+	if status := uploadTestBundle(t, ts.URL+"/repo/unbundled/import", bundleContent); status != 200 {
+		t.Fatalf("Expected downloaded bundle to be importable, got %v", status)
+	}
+
+	response, err = http.Get(ts.URL + "/git/bundled/bundle?ref=master~1..master")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	rangeBundle, _ := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+
+	if !bytes.Contains(rangeBundle, []byte("\n-")) {
+		t.Fatalf("Expected range bundle to have a prerequisite commit")
+	}
+
+	if status := doJSONRequest(t, http.MethodGet, ts.URL+"/git/bundled/bundle?ref=missing", nil, nil); status != 404 {
+		t.Fatalf("Expected status code 404 for missing ref, got %v", status)
+	}
+
+	if status := doJSONRequest(t, http.MethodGet, ts.URL+"/git/bundled/bundle?ref=missing..master", nil, nil); status != 404 {
+		t.Fatalf("Expected status code 404 for missing since ref, got %v", status)
+	}
+
+	if out, err := exec.Command("git", "-C", utils.GetRepoAbsolutePath("bundled"), "branch", "old", "master~1").CombinedOutput(); err != nil {
+		t.Fatalf("error, %v %s", err, out)
+	}
+
+	if status := doJSONRequest(t, http.MethodGet, ts.URL+"/git/bundled/bundle?ref=master..old", nil, nil); status != 400 {
+		t.Fatalf("Expected status code 400 for empty range, got %v", status)
+	}
+}
+
+func Test_NamespacedRepoEndpoints(t *testing.T) {
+	defer setupTestBaseDir(t)()
+
+	ts := httptest.NewServer(SetupServer())
+	defer ts.Close()
+
+	createTestRepo(t, ts.URL, "alice/project")
+	createTestRepo(t, ts.URL, "flat")
+	pushTestCommit(t, "alice/project", "master", map[string]string{"README.md": "hello"}, "initial commit")
+
+	// upload-pack rpc is served with protocol v0 only
+	lsRemote := exec.Command("git", "-c", "protocol.version=0", "ls-remote", ts.URL+"/git/alice/project")
+	if out, err := lsRemote.CombinedOutput(); err != nil || !bytes.Contains(out, []byte("refs/heads/master")) {
+		t.Fatalf("Expected namespaced repo to be served over smart http, got %v %s", err, out)
+	}
+
+	var logResponse struct {
+		Logs []utils.CommitItem `json:"logs"`
+	}
+
+	if status := doJSONRequest(t, http.MethodGet, ts.URL+"/git/alice/project/log", nil, &logResponse); status != 200 || len(logResponse.Logs) != 1 {
+		t.Fatalf("Expected namespaced repo log, got %v %v", status, logResponse.Logs)
+	}
+
+	for _, repoName := range []string{"alice", "flat/project"} {
+		if status := doJSONRequest(t, http.MethodPost, ts.URL+"/repo", RepoCreateRequest{RepoName: repoName}, nil); status != 409 {
+			t.Fatalf("Expected status code 409 for %s, got %v", repoName, status)
+		}
+	}
+
+	for _, repoName := range []string{"../escape", "alice/../flat", "a/b/c", "/abs"} {
+		if status := doJSONRequest(t, http.MethodPost, ts.URL+"/repo", RepoCreateRequest{RepoName: repoName}, nil); status != 400 {
+			t.Fatalf("Expected status code 400 for %s, got %v", repoName, status)
+		}
+	}
+
+	// an owner namespace or a path inside a flat repo is not a repo of its own
+	for _, repoName := range []string{"alice", "flat/project"} {
+		if status := doJSONRequest(t, http.MethodDelete, ts.URL+"/repo/"+repoName, nil, nil); status != 404 {
+			t.Fatalf("Expected status code 404 deleting %s, got %v", repoName, status)
+		}
+
+		if status := doJSONRequest(t, http.MethodPatch, ts.URL+"/repo/"+repoName, RepoUpdateRequest{RepoName: "moved"}, nil); status != 404 {
+			t.Fatalf("Expected status code 404 renaming %s, got %v", repoName, status)
+		}
+	}
+
+	if status := doJSONRequest(t, http.MethodGet, ts.URL+"/git/alice/log", nil, nil); status != 404 {
+		t.Fatalf("Expected status code 404 for namespace log, got %v", status)
+	}
+
+	if !utils.RepoExists("alice/project") || utils.RepoExists("alice") {
+		t.Fatalf("Expected only alice/project to exist as a repo")
+	}
+
+	var deleteResponse struct {
+		Trash utils.TrashItem `json:"trash"`
+	}
+
+	if status := doJSONRequest(t, http.MethodDelete, ts.URL+"/repo/alice/project", nil, &deleteResponse); status != 200 {
+		t.Fatalf("Expected status code 200, got %v", status)
+	}
+
+	if _, err := os.Stat(filepath.Join(config.REPO_BASE_DIR, "alice")); !os.IsNotExist(err) {
+		t.Fatalf("Expected empty namespace to be removed")
+	}
+
+	// the owner name got taken by a flat repo while alice/project was in trash
+	createTestRepo(t, ts.URL, "alice")
+
+	restoreURL := fmt.Sprintf("%s/trash/%s/restore", ts.URL, deleteResponse.Trash.ID)
+
+	if status := doJSONRequest(t, http.MethodPost, restoreURL, nil, nil); status != 409 {
+		t.Fatalf("Expected status code 409 restoring into a flat repo, got %v", status)
+	}
+}
+
+func Test_RepoCreateFromTemplateEndpoint(t *testing.T) {
+	defer setupTestBaseDir(t)()
+
+	ts := httptest.NewServer(SetupServer())
+	defer ts.Close()
+
+	createTestRepo(t, ts.URL, "template-source")
+	pushTestCommit(t, "template-source", "master", map[string]string{"main.go": "package main", "LICENSE": "old"}, "template commit")
+
+	request := RepoCreateRequest{
+		RepoName:      "from-template",
+		InitialBranch: "main",
+		Template: &utils.RepoTemplate{
+			Readme:    true,
+			Gitignore: "Go",
+			License:   "MIT",
+			Repo:      "template-source",
+			Author:    &utils.Author{Name: "Jane Doe", Email: "jane@example.com"},
+		},
+	}
+
+	var createResponse RepoCreateResponse
+
+	if status := doJSONRequest(t, http.MethodPost, ts.URL+"/repo", request, &createResponse); status != 200 {
+		t.Fatalf("Expected status code 200, got %v", status)
+	}
+
+	lsTree := exec.Command("git", "ls-tree", "--name-only", "main")
+	lsTree.Dir = utils.GetRepoAbsolutePath("from-template")
+	out, err := lsTree.CombinedOutput()
+
+	if err != nil || string(out) != ".gitignore\nLICENSE\nREADME.md\nmain.go\n" {
+		t.Fatalf("Expected template files on main branch, got %v %s", err, out)
+	}
+
+	showLicense := exec.Command("git", "show", createResponse.Commit+":LICENSE")
+	showLicense.Dir = utils.GetRepoAbsolutePath("from-template")
+
+	if out, err := showLicense.CombinedOutput(); err != nil || !bytes.Contains(out, []byte("Jane Doe")) {
+		t.Fatalf("Expected generated license to win over template repo license, got %v %s", err, out)
+	}
+
+	revList := exec.Command("git", "rev-list", "--count", "main")
+	revList.Dir = utils.GetRepoAbsolutePath("from-template")
+
+	if out, _ := revList.CombinedOutput(); string(out) != "1\n" {
+		t.Fatalf("Expected only the initial commit without template history, got %s", out)
+	}
+
+	request.RepoName = "bad-template"
+	request.Template.License = "unknown"
+
+	if status := doJSONRequest(t, http.MethodPost, ts.URL+"/repo", request, nil); status != 400 {
+		t.Fatalf("Expected status code 400 for unknown license, got %v", status)
+	}
+
+	if utils.CheckRepoExists("bad-template") != nil {
+		t.Fatalf("Expected no repo to be created for invalid template")
+	}
+}
+
+func Test_RepoMetadataEndpoints(t *testing.T) {
+	defer setupTestBaseDir(t)()
+
+	ts := httptest.NewServer(SetupServer())
+	defer ts.Close()
+
+	description := "repo with metadata"
+	createRequest := RepoCreateRequest{
+		RepoName: "with-metadata",
+		RepoMetadataUpdate: utils.RepoMetadataUpdate{
+			Description: &description,
+			Topics:      []string{"go", "git", "go"},
+		},
+	}
+
+	var createResponse RepoCreateResponse
+
+	if status := doJSONRequest(t, http.MethodPost, ts.URL+"/repo", createRequest, &createResponse); status != 200 {
+		t.Fatalf("Expected status code 200, got %v", status)
+	}
+
+	if createResponse.Metadata == nil || createResponse.Metadata.Description != description || len(createResponse.Metadata.Topics) != 2 {
+		t.Fatalf("Expected metadata in create response, got %v", createResponse.Metadata)
+	}
+
+	visibility := utils.RepoVisibility_Private
+	updateRequest := RepoUpdateRequest{
+		RepoMetadataUpdate: utils.RepoMetadataUpdate{Visibility: &visibility},
+	}
+
+	if status := doJSONRequest(t, http.MethodPatch, ts.URL+"/repo/with-metadata", updateRequest, nil); status != 200 {
+		t.Fatalf("Expected status code 200, got %v", status)
+	}
+
+	var getResponse struct {
+		Repo utils.RepoSummary `json:"repo"`
+	}
+
+	if status := doJSONRequest(t, http.MethodGet, ts.URL+"/repo/with-metadata", nil, &getResponse); status != 200 {
+		t.Fatalf("Expected status code 200, got %v", status)
+	}
+
+	metadata := getResponse.Repo.Metadata
+	if metadata == nil || metadata.Visibility != visibility || metadata.Description != description || metadata.CreatedAt.IsZero() {
+		t.Fatalf("Expected updated metadata to keep other fields, got %v", metadata)
+	}
+
+	updateRequest = RepoUpdateRequest{
+		RepoMetadataUpdate: utils.RepoMetadataUpdate{Topics: []string{"Not Valid"}},
+	}
+
+	if status := doJSONRequest(t, http.MethodPatch, ts.URL+"/repo/with-metadata", updateRequest, nil); status != 400 {
+		t.Fatalf("Expected status code 400 for invalid topic, got %v", status)
+	}
+}
+
+func Test_RepoDefaultBranchEndpoint(t *testing.T) {
+	defer setupTestBaseDir(t)()
+
+	ts := httptest.NewServer(SetupServer())
+	defer ts.Close()
+
+	createTestRepo(t, ts.URL, "branches")
+	pushTestCommit(t, "branches", "master", map[string]string{"README.md": "hello"}, "initial commit")
+	pushTestCommit(t, "branches", "develop", map[string]string{"README.md": "develop"}, "develop commit")
+
+	events := subscribeRepoEvents(t, "branches")
+
+	defaultBranchURL := ts.URL + "/repo/branches/default-branch"
+
+	if status := doJSONRequest(t, http.MethodPut, defaultBranchURL, DefaultBranchRequest{"missing"}, nil); status != 404 {
+		t.Fatalf("Expected status code 404 for missing branch, got %v", status)
+	}
+
+	if status := doJSONRequest(t, http.MethodPut, defaultBranchURL, DefaultBranchRequest{"develop"}, nil); status != 200 {
+		t.Fatalf("Expected status code 200, got %v", status)
+	}
+
+	var defaultBranchEvent models.RepoEvent
+
+	readRepoEvent(t, events, &defaultBranchEvent)
+
+	if defaultBranchEvent.Type != models.RepoEventType_DefaultBranch || defaultBranchEvent.Old != "master" || defaultBranchEvent.New != "develop" {
+		t.Fatalf("Expected default branch event, got %v", defaultBranchEvent)
+	}
+
+	if branch, _ := utils.GetDefaultBranch("branches"); branch != "develop" {
+		t.Fatalf("Expected HEAD to point to develop, got %v", branch)
+	}
+
+	// a detached HEAD is fixed by pointing it to a branch again
+	headSha, err := exec.Command("git", "-C", utils.GetRepoAbsolutePath("branches"), "rev-parse", "HEAD").Output()
+	if err != nil {
+		t.Fatalf("error, %v", err)
+	}
+
+	if err := ioutil.WriteFile(filepath.Join(utils.GetRepoAbsolutePath("branches"), "HEAD"), headSha, 0600); err != nil {
+		t.Fatalf("error, %v", err)
+	}
+
+	if status := doJSONRequest(t, http.MethodPut, defaultBranchURL, DefaultBranchRequest{"master"}, nil); status != 200 {
+		t.Fatalf("Expected status code 200 for detached HEAD, got %v", status)
+	}
+
+	var detachedEvent models.RepoEvent
+
+	readRepoEvent(t, events, &detachedEvent)
+
+	if detachedEvent.Old != "" || detachedEvent.New != "master" {
+		t.Fatalf("Expected default branch event from detached HEAD, got %v", detachedEvent)
+	}
+
+	if branch, _ := utils.GetDefaultBranch("branches"); branch != "master" {
+		t.Fatalf("Expected HEAD to point to master, got %v", branch)
+	}
+}
+
+func Test_RepoTreeEndpoint(t *testing.T) {
+	defer setupTestBaseDir(t)()
+
+	ts := httptest.NewServer(SetupServer())
+	defer ts.Close()
+
+	createTestRepo(t, ts.URL, "tree")
+	pushTestCommit(t, "tree", "feature/nested", map[string]string{
+		"README.md":       "hello",
+		"src/main.go":     "package main",
+		"src/lib/util.go": "package lib",
+	}, "initial commit")
+
+	type treeResponse struct {
+		Ref     string            `json:"ref"`
+		Commit  string            `json:"commit"`
+		Path    string            `json:"path"`
+		Entries []utils.TreeEntry `json:"entries"`
+	}
+
+	var response treeResponse
+
+	if status := doJSONRequest(t, http.MethodGet, ts.URL+"/git/tree/tree/feature/nested/src", nil, &response); status != 200 {
+		t.Fatalf("Expected status code 200, got %v", status)
+	}
+
+	if response.Ref != "feature/nested" || response.Path != "src" || len(response.Entries) != 2 {
+		t.Fatalf("Expected src listing of feature/nested, got %v", response)
+	}
+
+	lib, mainFile := response.Entries[0], response.Entries[1]
+
+	if lib.Type != "tree" || lib.Size != nil || lib.Path != "src/lib" {
+		t.Fatalf("Expected lib directory entry, got %v", lib)
+	}
+
+	if mainFile.Type != "blob" || mainFile.Mode != "100644" || mainFile.Size == nil || *mainFile.Size != 12 {
+		t.Fatalf("Expected main.go file entry with size, got %v", mainFile)
+	}
+
+	var shaResponse treeResponse
+
+	if status := doJSONRequest(t, http.MethodGet, ts.URL+"/git/tree/tree/"+response.Commit, nil, &shaResponse); status != 200 || len(shaResponse.Entries) != 2 {
+		t.Fatalf("Expected root listing by commit sha, got %v %v", status, shaResponse)
+	}
+
+	for _, missingPath := range []string{"/feature/nested/missing", "/missing-ref", "/feature/nested/../README.md"} {
+		if status := doJSONRequest(t, http.MethodGet, ts.URL+"/git/tree/tree"+missingPath, nil, nil); status != 404 {
+			t.Fatalf("Expected status code 404 for %s, got %v", missingPath, status)
+		}
+	}
+
+	if status := doJSONRequest(t, http.MethodGet, ts.URL+"/git/tree/tree/feature/nested/README.md", nil, nil); status != 400 {
+		t.Fatalf("Expected status code 400 for file path, got %v", status)
+	}
+}
+
+func Test_RepoRawFileEndpoint(t *testing.T) {
+	defer setupTestBaseDir(t)()
+
+	ts := httptest.NewServer(SetupServer())
+	defer ts.Close()
+
+	pngContent := "\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"
+
+	createTestRepo(t, ts.URL, "raw")
+	pushTestCommit(t, "raw", "master", map[string]string{
+		"docs/index.html": "<script>alert(1)</script>",
+		"logo.png":        pngContent,
+	}, "initial commit")
+
+	response, err := http.Get(ts.URL + "/git/raw/raw/master/docs/index.html")
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	content, _ := ioutil.ReadAll(response.Body)
+	response.Body.Close()
+
+	if response.StatusCode != 200 || string(content) != "<script>alert(1)</script>" {
+		t.Fatalf("Expected file content, got %v %s", response.StatusCode, content)
+	}
+
+	if response.Header.Get("Content-Type") != "text/plain; charset=utf-8" || response.Header.Get("Content-Length") != "25" {
+		t.Fatalf("Expected html to be served as plain text, got %v", response.Header)
+	}
+
+	etag := response.Header.Get("ETag")
+	request, _ := http.NewRequest(http.MethodGet, ts.URL+"/git/raw/raw/master/docs/index.html", nil)
+	request.Header.Set("If-None-Match", etag)
+
+	response, err = http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+
+	response.Body.Close()
+
+	if etag == "" || response.StatusCode != http.StatusNotModified {
+		t.Fatalf("Expected 304 for matching etag %q, got %v", etag, response.StatusCode)
+	}
+
+	if response.Header.Get("ETag") != etag || response.Header.Get("Cache-Control") != "no-cache" {
+		t.Fatalf("Expected 304 to carry etag and cache headers, got %v", response.Header)
+	}
+
+	var jsonResponse struct {
+		ContentType string         `json:"contentType"`
+		Binary      bool           `json:"binary"`
+		Content     string         `json:"content"`
+		File        utils.BlobInfo `json:"file"`
+	}
+
+	if status := doJSONRequest(t, http.MethodGet, ts.URL+"/git/raw/raw/master/logo.png?format=json", nil, &jsonResponse); status != 200 {
+		t.Fatalf("Expected status code 200, got %v", status)
+	}
+
+	decoded, _ := base64.StdEncoding.DecodeString(jsonResponse.Content)
+
+	if !jsonResponse.Binary || jsonResponse.ContentType != "image/png" || string(decoded) != pngContent || jsonResponse.File.Name != "logo.png" {
+		t.Fatalf("Expected binary png in json, got %v", jsonResponse)
+	}
+
+	if status := doJSONRequest(t, http.MethodGet, ts.URL+"/git/raw/raw/master/docs", nil, nil); status != 400 {
+		t.Fatalf("Expected status code 400 for directory, got %v", status)
+	}
+
+	if status := doJSONRequest(t, http.MethodGet, ts.URL+"/git/raw/raw/master/missing.txt", nil, nil); status != 404 {
+		t.Fatalf("Expected status code 404 for missing file, got %v", status)
+	}
+}
+
+func Test_RepoCommitEndpoint(t *testing.T) {
+	defer setupTestBaseDir(t)()
+
+	ts := httptest.NewServer(SetupServer())
+	defer ts.Close()
+
+	createTestRepo(t, ts.URL, "commit")
+	pushTestCommit(t, "commit", "master", map[string]string{
+		"old.txt":   "line one\nline two\nline three\nline four\n",
+		"image.bin": "\x00\x01\x02",
+	}, "initial commit")
+	pushTestCommit(t, "commit", "master", map[string]string{
+		"old.txt":   "",
+		"new.txt":   "line one\nline two\nline three\nline four\nline five\n",
+		"added.txt": "added\n",
+	}, "rename old.txt\n\nmove the file and add \"quoted\" lines\n\twith a tab")
+
+	type commitResponse struct {
+		Commit utils.CommitDetail `json:"commit"`
+	}
+
+	var response commitResponse
+
+	if status := doJSONRequest(t, http.MethodGet, ts.URL+"/git/commit/commit/master", nil, &response); status != 200 {
+		t.Fatalf("Expected status code 200, got %v", status)
+	}
+
+	commit := response.Commit
+
+	if commit.Subject != "rename old.txt" || commit.Body != "move the file and add \"quoted\" lines\n\twith a tab" {
+		t.Fatalf("Expected full commit message, got %q %q", commit.Subject, commit.Body)
+	}
+
+	if len(commit.Parents) != 1 || commit.Tree == "" || commit.Author.Email != "test@example.com" || commit.Patch != "" {
+		t.Fatalf("Expected commit with one parent and tree, got %v", commit)
+	}
+
+	if commit.Stats.FilesChanged != 2 || commit.Stats.Additions != 2 || commit.Stats.Deletions != 0 {
+		t.Fatalf("Expected 2 changed files with 2 additions, got %v", commit.Stats)
+	}
+
+	added, renamed := commit.Files[0], commit.Files[1]
+
+	if added.Path != "added.txt" || added.Status != utils.FileChangeStatus_Added || added.Additions != 1 {
+		t.Fatalf("Expected added.txt to be added, got %v", added)
+	}
+
+	if renamed.Path != "new.txt" || renamed.OldPath != "old.txt" || renamed.Status != utils.FileChangeStatus_Renamed || renamed.Additions != 1 {
+		t.Fatalf("Expected old.txt to be renamed to new.txt, got %v", renamed)
+	}
+
+	var rootResponse commitResponse
+
+	if status := doJSONRequest(t, http.MethodGet, ts.URL+"/git/commit/commit/"+commit.Parents[0]+"?patch=true", nil, &rootResponse); status != 200 {
+		t.Fatalf("Expected status code 200, got %v", status)
+	}
+
+	root := rootResponse.Commit
+
+	if len(root.Parents) != 0 || root.Body != "" || len(root.Files) != 2 || !root.Files[0].Binary || root.Files[0].Status != utils.FileChangeStatus_Added {
+		t.Fatalf("Expected root commit adding a binary file, got %v", root)
+	}
+
+	if !strings.Contains(root.Patch, "+line four") {
+		t.Fatalf("Expected unified patch of root commit, got %q", root.Patch)
+	}
+
+	for _, missingRev := range []string{"missing", "--all", "0000000000000000000000000000000000000000"} {
+		if status := doJSONRequest(t, http.MethodGet, ts.URL+"/git/commit/commit/"+missingRev, nil, nil); status != 404 {
+			t.Fatalf("Expected status code 404 for %s, got %v", missingRev, status)
+		}
+	}
+}
+
+func Test_RepoCompareEndpoint(t *testing.T) {
+	defer setupTestBaseDir(t)()
+
+	ts := httptest.NewServer(SetupServer())
+	defer ts.Close()
+
+	createTestRepo(t, ts.URL, "compare")
+	pushTestCommit(t, "compare", "master", map[string]string{"README.md": "hello\n"}, "initial commit")
+
+	if out, err := exec.Command("git", "-C", utils.GetRepoAbsolutePath("compare"), "branch", "feature", "master").CombinedOutput(); err != nil {
+		t.Fatalf("error, %v %s", err, out)
+	}
+
+	pushTestCommit(t, "compare", "feature", map[string]string{"feature.txt": "one\n"}, "first feature commit")
+	pushTestCommit(t, "compare", "feature", map[string]string{"feature.txt": "one\ntwo\n"}, "second feature commit\n\nwith body")
+	pushTestCommit(t, "compare", "master", map[string]string{"README.md": "hello\nworld\n"}, "master commit")
+	pushTestCommit(t, "compare", "orphan", map[string]string{"other.txt": "other\n"}, "unrelated commit")
+
+	type compareResponse struct {
+		Comparison utils.CompareResult `json:"comparison"`
+	}
+
+	var response compareResponse
+
+	if status := doJSONRequest(t, http.MethodGet, ts.URL+"/git/compare/compare/master...feature?patch=true", nil, &response); status != 200 {
+		t.Fatalf("Expected status code 200, got %v", status)
+	}
+
+	comparison := response.Comparison
+
+	if comparison.AheadBy != 2 || comparison.BehindBy != 1 || comparison.MergeBase == "" || comparison.CommitsTruncated {
+		t.Fatalf("Expected feature 2 ahead and 1 behind master, got %v", comparison)
+	}
+
+	if len(comparison.Commits) != 2 || comparison.Commits[0].Subject != "second feature commit" || comparison.Commits[0].Body != "with body" {
+		t.Fatalf("Expected feature commits newest first, got %v", comparison.Commits)
+	}
+
+	if comparison.Stats.FilesChanged != 1 || comparison.Files[0].Path != "feature.txt" || comparison.Files[0].Additions != 2 {
+		t.Fatalf("Expected only feature.txt changed since merge base, got %v", comparison.Files)
+	}
+
+	if !strings.Contains(comparison.Patch, "+two") || strings.Contains(comparison.Patch, "README.md") {
+		t.Fatalf("Expected patch of feature changes only, got %q", comparison.Patch)
+	}
+
+	if status := doJSONRequest(t, http.MethodGet, ts.URL+"/git/compare/compare/feature...feature", nil, &response); status != 200 ||
+		response.Comparison.AheadBy != 0 || len(response.Comparison.Commits) != 0 || len(response.Comparison.Files) != 0 {
+		t.Fatalf("Expected empty comparison of a ref to itself, got %v %v", status, response.Comparison)
+	}
+
+	for compareRange, expectedStatus := range map[string]int{
+		"master..feature":  400,
+		"master...":        400,
+		"master...orphan":  400,
+		"master...missing": 404,
+		"--all...feature":  404,
+	} {
+		if status := doJSONRequest(t, http.MethodGet, ts.URL+"/git/compare/compare/"+compareRange, nil, nil); status != expectedStatus {
+			t.Fatalf("Expected status code %v for %s, got %v", expectedStatus, compareRange, status)
+		}
+	}
+}
+
+func Test_RepoBranchesAndTagsEndpoints(t *testing.T) {
+	defer setupTestBaseDir(t)()
+
+	ts := httptest.NewServer(SetupServer())
+	defer ts.Close()
+
+	createTestRepo(t, ts.URL, "refs")
+
+	type branchesResponse struct {
+		Branches []utils.BranchItem `json:"branches"`
+		Total    int                `json:"total"`
+	}
+
+	var emptyResponse branchesResponse
+
+	if status := doJSONRequest(t, http.MethodGet, ts.URL+"/git/refs/branches", nil, &emptyResponse); status != 200 || len(emptyResponse.Branches) != 0 {
+		t.Fatalf("Expected no branches in empty repo, got %v %v", status, emptyResponse)
+	}
+
+	pushTestCommit(t, "refs", "master", map[string]string{"README.md": "hello"}, "initial commit")
+	pushTestCommit(t, "refs", "feature", map[string]string{"feature.txt": "feature"}, "feature commit")
+
+	repoPath := utils.GetRepoAbsolutePath("refs")
+
+	for _, args := range [][]string{
+		{"tag", "v1", "master"},
+		{"tag", "-a", "v2", "-m", "release v2\n\nwith notes", "master"},
+		{"tag", "-a", "v3", "-m", "tag of a tag", "v2"},
+	} {
+		gitArgs := append([]string{"-C", repoPath, "-c", "user.name=Tagger", "-c", "user.email=tagger@example.com"}, args...)
+		if out, err := exec.Command("git", gitArgs...).CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v %s", args, err, out)
+		}
+	}
+
+	var response branchesResponse
+
+	if status := doJSONRequest(t, http.MethodGet, ts.URL+"/git/refs/branches?page=1&per_page=1", nil, &response); status != 200 {
+		t.Fatalf("Expected status code 200, got %v", status)
+	}
+
+	if response.Total != 2 || len(response.Branches) != 1 || response.Branches[0].Name != "master" || !response.Branches[0].Default {
+		t.Fatalf("Expected default master branch on second page, got %v", response)
+	}
+
+	if status := doJSONRequest(t, http.MethodGet, ts.URL+"/git/refs/branches?page=9223372036854775807&per_page=2", nil, &response); status != 200 || len(response.Branches) != 0 {
+		t.Fatalf("Expected huge page to be empty, got %v %v", status, response)
+	}
+
+	doJSONRequest(t, http.MethodGet, ts.URL+"/git/refs/branches?page=1&per_page=1", nil, &response)
+
+	if response.Branches[0].Commit.Subject != "initial commit" || response.Branches[0].Commit.Commit == "" {
+		t.Fatalf("Expected master branch commit, got %v", response.Branches[0].Commit)
+	}
+
+	type tagsResponse struct {
+		Tags  []utils.TagItem `json:"tags"`
+		Total int             `json:"total"`
+	}
+
+	var tags tagsResponse
+
+	if status := doJSONRequest(t, http.MethodGet, ts.URL+"/git/refs/tags", nil, &tags); status != 200 || tags.Total != 3 || len(tags.Tags) != 3 {
+		t.Fatalf("Expected 3 tags, got %v %v", status, tags)
+	}
+
+	lightweight, annotated, nested := tags.Tags[0], tags.Tags[1], tags.Tags[2]
+	masterSha := response.Branches[0].Commit.Commit
+
+	if lightweight.Annotated || lightweight.Tagger != nil || lightweight.Target != masterSha || lightweight.Commit == nil {
+		t.Fatalf("Expected lightweight v1 tag of master, got %v", lightweight)
+	}
+
+	if !annotated.Annotated || annotated.Sha == masterSha || annotated.Target != masterSha || annotated.TargetType != "commit" {
+		t.Fatalf("Expected annotated v2 tag peeled to master, got %v", annotated)
+	}
+
+	if annotated.Message != "release v2\n\nwith notes" || annotated.Tagger == nil || annotated.Tagger.Email != "tagger@example.com" {
+		t.Fatalf("Expected v2 tagger and message, got %v %v", annotated.Tagger, annotated.Message)
+	}
+
+	if nested.Target != masterSha || nested.Commit == nil || nested.Commit.Subject != "initial commit" {
+		t.Fatalf("Expected v3 tag peeled through v2 to master, got %v", nested)
+	}
+}
+
+func Test_RepoBlameEndpoint(t *testing.T) {
+	defer setupTestBaseDir(t)()
+
+	ts := httptest.NewServer(SetupServer())
+	defer ts.Close()
+
+	createTestRepo(t, ts.URL, "blame")
+	pushTestCommit(t, "blame", "master", map[string]string{"file.txt": "one\ntwo\nthree\nfour\n"}, "initial commit")
+	pushTestCommit(t, "blame", "master", map[string]string{"file.txt": "one\nTWO\nthree\nfour\n\tindented\n"}, "change two")
+
+	type blameResponse struct {
+		Commit string             `json:"commit"`
+		Ranges []utils.BlameRange `json:"ranges"`
+	}
+
+	var response blameResponse
+
+	if status := doJSONRequest(t, http.MethodGet, ts.URL+"/git/blame/blame/master/file.txt", nil, &response); status != 200 {
+		t.Fatalf("Expected status code 200, got %v", status)
+	}
+
+	if len(response.Ranges) != 4 {
+		t.Fatalf("Expected 4 blame ranges, got %v", response.Ranges)
+	}
+
+	first, changed, unchanged, last := response.Ranges[0], response.Ranges[1], response.Ranges[2], response.Ranges[3]
+
+	if first.Subject != "initial commit" || first.StartLine != 1 || first.EndLine != 1 || first.Author.Email != "test@example.com" || first.Author.Date == "" {
+		t.Fatalf("Expected first line from initial commit, got %v", first)
+	}
+
+	if changed.Commit != response.Commit || changed.Subject != "change two" || changed.StartLine != 2 || changed.Lines[0] != "TWO" {
+		t.Fatalf("Expected second line from last commit, got %v", changed)
+	}
+
+	if unchanged.Commit != first.Commit || unchanged.StartLine != 3 || unchanged.EndLine != 4 || len(unchanged.Lines) != 2 {
+		t.Fatalf("Expected lines 3 to 4 grouped from initial commit, got %v", unchanged)
+	}
+
+	if last.Commit != response.Commit || last.Lines[0] != "\tindented" {
+		t.Fatalf("Expected indented line kept as is, got %v", last)
+	}
+
+	if status := doJSONRequest(t, http.MethodGet, ts.URL+"/git/blame/blame/master/file.txt?start=2&end=3", nil, &response); status != 200 ||
+		len(response.Ranges) != 2 || response.Ranges[0].StartLine != 2 || response.Ranges[1].EndLine != 3 {
+		t.Fatalf("Expected blame of lines 2 to 3, got %v %v", status, response.Ranges)
+	}
+
+	for blamePath, expectedStatus := range map[string]int{
+		"master/missing.txt":                   404,
+		"missing/file.txt":                     404,
+		"master/file.txt?start=10":             400,
+		"master/file.txt?start=3&end=2":        400,
+		"master/file.txt?start=abc":            400,
+		"master/file.txt?start=0&end=2":        400,
+		response.Commit[:7] + "/file.txt?end=": 400,
+	} {
+		if status := doJSONRequest(t, http.MethodGet, ts.URL+"/git/blame/blame/"+blamePath, nil, nil); status != expectedStatus {
+			t.Fatalf("Expected status code %v for %s, got %v", expectedStatus, blamePath, status)
+		}
+	}
+}
+
+func Test_RepoArchiveEndpoint(t *testing.T) {
+	defer setupTestBaseDir(t)()
+
+	ts := httptest.NewServer(SetupServer())
+	defer ts.Close()
+
+	createTestRepo(t, ts.URL, "archive")
+	pushTestCommit(t, "archive", "feature/x", map[string]string{
+		".gitattributes": "secret.txt export-ignore\n",
+		"secret.txt":     "secret",
+		"README.md":      "hello",
+		"src/main.go":    "package main",
+	}, "initial commit")
+
+	getArchive := func(archivePath string) (*http.Response, []byte) {
+		resp, err := http.Get(ts.URL + "/git/archive/archive/" + archivePath)
+		if err != nil {
+			t.Fatalf("error, %v", err)
+		}
+
+		defer resp.Body.Close()
+
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			t.Fatalf("error, %v", err)
+		}
+
+		return resp, body
+	}
+
+	resp, body := getArchive("feature/x.tar.gz")
+
+	if resp.StatusCode != 200 || resp.Header.Get("Content-Type") != "application/gzip" || resp.Header.Get("Pragma") != "no-cache" {
+		t.Fatalf("Expected uncached tar.gz archive, got %v %v", resp.StatusCode, resp.Header)
+	}
+
+	if resp.Header.Get("Content-Disposition") != `attachment; filename="archive-feature-x.tar.gz"` {
+		t.Fatalf("Expected archive file name, got %v", resp.Header.Get("Content-Disposition"))
+	}
+
+	gzipReader, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		t.Fatalf("error, %v", err)
+	}
+
+	tarNames := []string{}
+	tarReader := tar.NewReader(gzipReader)
+
+	for {
+		header, err := tarReader.Next()
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			t.Fatalf("error, %v", err)
+		}
+
+		// git stores the commit sha in a global pax header
+		if header.Typeflag != tar.TypeXGlobalHeader {
+			tarNames = append(tarNames, header.Name)
+		}
+	}
+
+	if strings.Join(tarNames, ",") != "archive-feature-x/,archive-feature-x/.gitattributes,archive-feature-x/README.md,archive-feature-x/src/,archive-feature-x/src/main.go" {
+		t.Fatalf("Expected prefixed files without export-ignored secret.txt, got %v", tarNames)
+	}
+
+	var branches struct {
+		Branches []utils.BranchItem `json:"branches"`
+	}
+
+	doJSONRequest(t, http.MethodGet, ts.URL+"/git/archive/branches", nil, &branches)
+	commitSha := branches.Branches[0].Commit.Commit
+
+	resp, body = getArchive(commitSha + ".zip?path=src")
+
+	if resp.StatusCode != 200 || resp.Header.Get("Content-Type") != "application/zip" || resp.Header.Get("Cache-Control") != "public, max-age=31536000" {
+		t.Fatalf("Expected cached zip archive of commit, got %v %v", resp.StatusCode, resp.Header)
+	}
+
+	zipReader, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatalf("error, %v", err)
+	}
+
+	zipNames := []string{}
+
+	for _, file := range zipReader.File {
+		zipNames = append(zipNames, file.Name)
+	}
+
+	if strings.Join(zipNames, ",") != "archive-"+commitSha+"/,archive-"+commitSha+"/src/,archive-"+commitSha+"/src/main.go" {
+		t.Fatalf("Expected only src directory in zip, got %v", zipNames)
+	}
+
+	for archivePath, expectedStatus := range map[string]int{
+		"feature/x.rar":                400,
+		"feature/x.zip?path=README.md": 400,
+		"feature/x.zip?path=missing":   404,
+		"feature/x.zip?path=../src":    404,
+		"missing.zip":                  404,
+	} {
+		if resp, _ := getArchive(archivePath); resp.StatusCode != expectedStatus {
+			t.Fatalf("Expected status code %v for %s, got %v", expectedStatus, archivePath, resp.StatusCode)
+		}
+	}
+}
+
+func Test_RepoLogFilters(t *testing.T) {
+	defer setupTestBaseDir(t)()
+
+	ts := httptest.NewServer(SetupServer())
+	defer ts.Close()
+
+	createTestRepo(t, ts.URL, "log")
+	pushTestCommit(t, "log", "master", map[string]string{"a.txt": "1"}, "add a")
+
+	os.Setenv("GIT_AUTHOR_NAME", "Other Author")
+	pushTestCommit(t, "log", "master", map[string]string{"b.txt": "1"}, "add b")
+	os.Unsetenv("GIT_AUTHOR_NAME")
+
+	pushTestCommit(t, "log", "master", map[string]string{"a.txt": "2"}, "update a to fix bug")
+
+	repoPath := utils.GetRepoAbsolutePath("log")
+
+	if out, err := exec.Command("git", "-C", repoPath, "branch", "feature", "master").CombinedOutput(); err != nil {
+		t.Fatalf("error, %v %s", err, out)
+	}
+
+	pushTestCommit(t, "log", "feature", map[string]string{"c.txt": "1"}, "feature work")
+
+	mergeCommand := exec.Command("git", "-C", repoPath, "-c", "user.name=Test User", "-c", "user.email=test@example.com",
+		"commit-tree", "feature^{tree}", "-p", "master", "-p", "feature", "-m", "merge feature")
+
+	mergeSha, err := mergeCommand.Output()
+	if err != nil {
+		t.Fatalf("error, %v", err)
+	}
+
+	if out, err := exec.Command("git", "-C", repoPath, "update-ref", "refs/heads/master", strings.TrimSpace(string(mergeSha))).CombinedOutput(); err != nil {
+		t.Fatalf("error, %v %s", err, out)
+	}
+
+	type logResponse struct {
+		Logs []utils.CommitItem `json:"logs"`
+	}
+
+	for query, expectedSubjects := range map[string]string{
+		"":                         "merge feature,feature work,update a to fix bug,add b,add a",
+		"?path=a.txt":              "update a to fix bug,add a",
+		"?author=Other":            "add b",
+		"?committer=Test":          "merge feature,feature work,update a to fix bug,add b,add a",
+		"?grep=bug":                "update a to fix bug",
+		"?no_merges=true":          "feature work,update a to fix bug,add b,add a",
+		"?first_parent=true":       "merge feature,update a to fix bug,add b,add a",
+		"?ref=feature&path=c.txt":  "feature work",
+		"?since=2090-01-01":        "",
+		"?until=2000-01-01":        "",
+		"?author=--all":            "",
+		"?grep=--output=/tmp/nope": "",
+	} {
+		var response logResponse
+
+		if status := doJSONRequest(t, http.MethodGet, ts.URL+"/git/log/log"+query, nil, &response); status != 200 {
+			t.Fatalf("Expected status code 200 for %s, got %v", query, status)
+		}
+
+		subjects := []string{}
+
+		for _, commit := range response.Logs {
+			subjects = append(subjects, commit.Subject)
+		}
+
+		// commits made in the same second have no fixed order
+		expected := strings.Split(expectedSubjects, ",")
+		sort.Strings(expected)
+		sort.Strings(subjects)
+
+		if strings.Join(subjects, ",") != strings.Join(expected, ",") {
+			t.Fatalf("Expected %s for %s, got %v", expectedSubjects, query, subjects)
+		}
+	}
+
+	for query, expectedStatus := range map[string]int{
+		"?ref=missing":   404,
+		"?ref=--all":     404,
+		"?path=../a.txt": 400,
+	} {
+		if status := doJSONRequest(t, http.MethodGet, ts.URL+"/git/log/log"+query, nil, nil); status != expectedStatus {
+			t.Fatalf("Expected status code %v for %s, got %v", expectedStatus, query, status)
+		}
+	}
+}
+
+func Test_RepoLogCursorPagination(t *testing.T) {
+	defer setupTestBaseDir(t)()
+
+	ts := httptest.NewServer(SetupServer())
+	defer ts.Close()
+
+	createTestRepo(t, ts.URL, "pages")
+
+	var emptyResponse struct {
+		Logs []utils.CommitItem `json:"logs"`
+	}
+
+	if status := doJSONRequest(t, http.MethodGet, ts.URL+"/git/pages/log", nil, &emptyResponse); status != 200 || emptyResponse.Logs == nil || len(emptyResponse.Logs) != 0 {
+		t.Fatalf("Expected empty log of empty repo, got %v %v", status, emptyResponse)
+	}
+
+	for i := 1; i <= 5; i++ {
+		pushTestCommit(t, "pages", "master", map[string]string{"file.txt": fmt.Sprint(i)}, fmt.Sprintf("commit %d", i))
+	}
+
+	type logResponse struct {
+		Logs       []utils.CommitItem `json:"logs"`
+		Head       string             `json:"head"`
+		NextCursor string             `json:"nextCursor"`
+		PerPage    int64              `json:"perPage"`
+	}
+
+	getPage := func(pageURL string) (logResponse, string) {
+		resp, err := http.Get(ts.URL + pageURL)
+		if err != nil {
+			t.Fatalf("error, %v", err)
+		}
+
+		defer resp.Body.Close()
+
+		var response logResponse
+
+		if err := json.NewDecoder(resp.Body).Decode(&response); err != nil || resp.StatusCode != 200 {
+			t.Fatalf("Expected status code 200 for %s, got %v %v", pageURL, resp.StatusCode, err)
+		}
+
+		link := resp.Header.Get("Link")
+		if link == "" {
+			return response, ""
+		}
+
+		if !strings.HasPrefix(link, "<") || !strings.HasSuffix(link, `>; rel="next"`) {
+			t.Fatalf("Expected next Link header, got %s", link)
+		}
+
+		return response, strings.TrimSuffix(strings.TrimPrefix(link, "<"), `>; rel="next"`)
+	}
+
+	subjects := []string{}
+	pageURL := "/git/pages/log?per_page=2"
+	pagesCount := 0
+
+	for pageURL != "" {
+		response, nextURL := getPage(pageURL)
+
+		if response.PerPage != 2 || len(response.Logs) == 0 || len(response.Logs) > 2 {
+			t.Fatalf("Expected pages of up to 2 commits, got %v", response)
+		}
+
+		if (nextURL == "") != (response.NextCursor == "") {
+			t.Fatalf("Expected next cursor only with Link header, got %v %s", response.NextCursor, nextURL)
+		}
+
+		for _, commit := range response.Logs {
+			subjects = append(subjects, commit.Subject)
+		}
+
+		// commits pushed between pages do not shift the later pages
+		if pagesCount == 0 {
+			pushTestCommit(t, "pages", "master", map[string]string{"file.txt": "6"}, "commit 6")
+		}
+
+		pageURL = nextURL
+		pagesCount++
+	}
+
+	if pagesCount != 3 || strings.Join(subjects, ",") != "commit 5,commit 4,commit 3,commit 2,commit 1" {
+		t.Fatalf("Expected 5 commits in 3 pages, got %v in %v pages", subjects, pagesCount)
+	}
+
+	if response, _ := getPage("/git/pages/log"); response.PerPage != 1000 || len(response.Logs) != 6 {
+		t.Fatalf("Expected default per_page of 1000, got %v", response.PerPage)
+	}
+
+	if response, _ := getPage("/git/pages/log?per_page=5000"); response.PerPage != config.MaxPerPageCommitCount || len(response.Logs) != 6 {
+		t.Fatalf("Expected per_page capped to max, got %v", response.PerPage)
+	}
+
+	if response, _ := getPage("/git/pages/log?page=1&per_page=4"); len(response.Logs) != 2 || response.NextCursor != "" {
+		t.Fatalf("Expected last 2 commits on second page, got %v", response.Logs)
+	}
+
+	pushTestCommit(t, "pages", "other", map[string]string{"other.txt": "1"}, "unrelated commit")
+
+	var branches struct {
+		Branches []utils.BranchItem `json:"branches"`
+	}
+
+	doJSONRequest(t, http.MethodGet, ts.URL+"/git/pages/branches", nil, &branches)
+	otherSha := branches.Branches[1].Commit.Commit
+
+	for _, cursor := range []string{"abc", "--all", otherSha} {
+		if status := doJSONRequest(t, http.MethodGet, ts.URL+"/git/pages/log?after="+cursor, nil, nil); status != 400 {
+			t.Fatalf("Expected status code 400 for cursor %s, got %v", cursor, status)
+		}
+	}
+}
+
+func Test_RepoGraphEndpoint(t *testing.T) {
+	defer setupTestBaseDir(t)()
+
+	ts := httptest.NewServer(SetupServer())
+	defer ts.Close()
+
+	createTestRepo(t, ts.URL, "graph")
+	pushTestCommit(t, "graph", "master", map[string]string{"a.txt": "a"}, "root")
+
+	repoPath := utils.GetRepoAbsolutePath("graph")
+
+	if out, err := exec.Command("git", "-C", repoPath, "branch", "feature", "master").CombinedOutput(); err != nil {
+		t.Fatalf("error, %v %s", err, out)
+	}
+
+	pushTestCommit(t, "graph", "master", map[string]string{"b.txt": "b"}, "master work")
+	pushTestCommit(t, "graph", "feature", map[string]string{"f.txt": "f"}, "feature work")
+
+	mergeSha, err := exec.Command("git", "-C", repoPath, "-c", "user.name=Test User", "-c", "user.email=test@example.com",
+		"commit-tree", "master^{tree}", "-p", "master", "-p", "feature", "-m", "merge feature").Output()
+	if err != nil {
+		t.Fatalf("error, %v", err)
+	}
+
+	if out, err := exec.Command("git", "-C", repoPath, "update-ref", "refs/heads/master", strings.TrimSpace(string(mergeSha))).CombinedOutput(); err != nil {
+		t.Fatalf("error, %v %s", err, out)
+	}
+
+	type graphResponse struct {
+		Commits    []utils.GraphCommit `json:"commits"`
+		Heads      []string            `json:"heads"`
+		NextCursor string              `json:"nextCursor"`
+	}
+
+	var response graphResponse
+
+	if status := doJSONRequest(t, http.MethodGet, ts.URL+"/git/graph/graph", nil, &response); status != 200 || len(response.Commits) != 4 {
+		t.Fatalf("Expected 4 commits in graph, got %v %v", status, response)
+	}
+
+	merge, root := response.Commits[0], response.Commits[3]
+
+	if merge.Subject != "merge feature" || len(merge.Parents) != 2 || merge.Lane != 0 || !reflect.DeepEqual(merge.ParentLanes, []int{0, 1}) {
+		t.Fatalf("Expected merge commit in first lane with parents in 2 lanes, got %v", merge)
+	}
+
+	featureRefs := 0
+
+	for _, commit := range response.Commits {
+		if reflect.DeepEqual(commit.Refs, []string{"refs/heads/feature"}) && commit.Subject == "feature work" {
+			featureRefs++
+		}
+	}
+
+	if !reflect.DeepEqual(merge.Refs, []string{"refs/heads/master"}) || featureRefs != 1 {
+		t.Fatalf("Expected branch decorations, got %v", response.Commits)
+	}
+
+	if root.Subject != "root" || len(root.Parents) != 0 || len(root.ParentLanes) != 0 {
+		t.Fatalf("Expected root commit last, got %v", root)
+	}
+
+	resp, err := http.Get(ts.URL + "/git/graph/graph?per_page=2")
+	if err != nil {
+		t.Fatalf("error, %v", err)
+	}
+
+	var firstPage graphResponse
+
+	_ = json.NewDecoder(resp.Body).Decode(&firstPage)
+	resp.Body.Close()
+
+	link := resp.Header.Get("Link")
+
+	if len(firstPage.Commits) != 2 || firstPage.NextCursor != firstPage.Commits[1].Commit || !strings.Contains(link, "after="+firstPage.NextCursor) {
+		t.Fatalf("Expected first page of 2 commits with next link, got %v %s", firstPage, link)
+	}
+
+	nextURL := strings.TrimSuffix(strings.TrimPrefix(link, "<"), `>; rel="next"`)
+
+	var secondPage graphResponse
+
+	if status := doJSONRequest(t, http.MethodGet, ts.URL+nextURL, nil, &secondPage); status != 200 || len(secondPage.Commits) != 2 || secondPage.NextCursor != "" {
+		t.Fatalf("Expected last page of 2 commits, got %v %v", status, secondPage)
+	}
+
+	// lanes continue from the first page
+	for i, commit := range secondPage.Commits {
+		if commit.Commit != response.Commits[i+2].Commit || commit.Lane != response.Commits[i+2].Lane {
+			t.Fatalf("Expected second page to match the full graph, got %v", commit)
+		}
+	}
+
+	var featureGraph graphResponse
+
+	if status := doJSONRequest(t, http.MethodGet, ts.URL+"/git/graph/graph?ref=feature", nil, &featureGraph); status != 200 || len(featureGraph.Commits) != 2 {
+		t.Fatalf("Expected 2 commits in feature graph, got %v %v", status, featureGraph)
+	}
+
+	for query, expectedStatus := range map[string]int{
+		"?ref=missing":                       404,
+		"?after=abc":                         400,
+		"?ref=feature&after=" + merge.Commit: 400,
+	} {
+		if status := doJSONRequest(t, http.MethodGet, ts.URL+"/git/graph/graph"+query, nil, nil); status != expectedStatus {
+			t.Fatalf("Expected status code %v for %s, got %v", expectedStatus, query, status)
+		}
+	}
+}
+
+func Test_RepoSearchEndpoint(t *testing.T) {
+	defer setupTestBaseDir(t)()
+
+	ts := httptest.NewServer(SetupServer())
+	defer ts.Close()
+
+	createTestRepo(t, ts.URL, "search")
+	pushTestCommit(t, "search", "master", map[string]string{
+		"src/main.go":     "package main\n\nfunc main() {\n\tprintln(\"Hello\")\n}\n",
+		"src/lib/util.go": "package lib\n\n// hello helper\nfunc Hello() string { return \"hello\" }\n",
+		"docs/a:b-c.md":   "say hello.*\n",
+		"image.bin":       "hello\x00binary",
+	}, "initial commit")
+
+	type searchResponse struct {
+		Commit    string               `json:"commit"`
+		Results   []utils.SearchResult `json:"results"`
+		Truncated bool                 `json:"truncated"`
+	}
+
+	search := func(query string) searchResponse {
+		var response searchResponse
+
+		if status := doJSONRequest(t, http.MethodGet, ts.URL+"/git/search/search?"+query, nil, &response); status != 200 {
+			t.Fatalf("Expected status code 200 for %s, got %v", query, status)
+		}
+
+		return response
+	}
+
+	matchedPaths := func(response searchResponse) string {
+		paths := []string{}
+
+		for _, result := range response.Results {
+			paths = append(paths, fmt.Sprintf("%s:%d", result.Path, result.LineNumber))
+		}
+
+		return strings.Join(paths, ",")
+	}
+
+	for query, expectedPaths := range map[string]string{
+		"q=hello":                            "docs/a:b-c.md:1,src/lib/util.go:3,src/lib/util.go:4",
+		"q=hello&ignore_case=true":           "docs/a:b-c.md:1,src/lib/util.go:3,src/lib/util.go:4,src/main.go:4",
+		"q=hello.*":                          "docs/a:b-c.md:1",
+		"q=H.llo&regex=true":                 "src/lib/util.go:4,src/main.go:4",
+		"q=hello&path=src/**/*.go":           "src/lib/util.go:3,src/lib/util.go:4",
+		"q=hello&path=docs&path=src/main.go": "docs/a:b-c.md:1",
+		"q=-e&ref=master":                    "",
+	} {
+		if paths := matchedPaths(search(query)); paths != expectedPaths {
+			t.Fatalf("Expected %s for %s, got %s", expectedPaths, query, paths)
+		}
+	}
+
+	capped := search("q=package&max_results=1")
+
+	if len(capped.Results) != 1 || !capped.Truncated {
+		t.Fatalf("Expected 1 result with truncated flag, got %v", capped)
+	}
+
+	withContext := search("q=println&context=2")
+	match := withContext.Results[0]
+
+	if match.Path != "src/main.go" || match.LineNumber != 4 || match.Line != "\tprintln(\"Hello\")" {
+		t.Fatalf("Expected println match in main.go, got %v", match)
+	}
+
+	if len(match.Before) != 2 || match.Before[0].LineNumber != 2 || match.Before[1].Line != "func main() {" || len(match.After) != 1 || match.After[0].Line != "}" {
+		t.Fatalf("Expected 2 lines before and 1 after the match, got %v %v", match.Before, match.After)
+	}
+
+	for query, expectedStatus := range map[string]int{
+		"q=":                           400,
+		"q=(&regex=true":               400,
+		"q=%28%3Fi%29hello&regex=true": 400,
+		"q=hello&path=../src":          400,
+		"q=hello&ref=missing":          404,
+		"q=hello&ref=--all":            404,
+	} {
+		if status := doJSONRequest(t, http.MethodGet, ts.URL+"/git/search/search?"+query, nil, nil); status != expectedStatus {
+			t.Fatalf("Expected status code %v for %s, got %v", expectedStatus, query, status)
+		}
+	}
+}
+
+func Test_RepoStatsEndpoint(t *testing.T) {
+	defer setupTestBaseDir(t)()
+
+	ts := httptest.NewServer(SetupServer())
+	defer ts.Close()
+
+	createTestRepo(t, ts.URL, "stats")
+
+	type statsResponse struct {
+		Stats utils.RepoStats `json:"stats"`
+	}
+
+	var response statsResponse
+
+	if status := doJSONRequest(t, http.MethodGet, ts.URL+"/git/stats/stats", nil, &response); status != 200 || response.Stats.TotalCommits != 0 {
+		t.Fatalf("Expected empty stats of empty repo, got %v %v", status, response)
+	}
+
+	pushAs := func(name string, email string, date string, files map[string]string, message string) {
+		os.Setenv("GIT_AUTHOR_NAME", name)
+		os.Setenv("GIT_AUTHOR_EMAIL", email)
+		os.Setenv("GIT_AUTHOR_DATE", date)
+
+		defer func() {
+			os.Unsetenv("GIT_AUTHOR_NAME")
+			os.Unsetenv("GIT_AUTHOR_EMAIL")
+			os.Unsetenv("GIT_AUTHOR_DATE")
+		}()
+
+		pushTestCommit(t, "stats", "master", files, message)
+	}
+
+	pushAs("Jane", "jane@old.com", "2024-01-03T10:00:00Z", map[string]string{"a.txt": "1\n", "b.txt": "b\n"}, "first")
+	pushAs("Jane D", "jane@new.com", "2024-01-08T10:00:00Z", map[string]string{"a.txt": "1\n2\n"}, "second")
+	pushAs("Test User", "test@example.com", "2024-01-09T10:00:00Z", map[string]string{
+		".mailmap": "Jane Doe <jane@new.com>\nJane Doe <jane@new.com> <jane@old.com>\n",
+		"a.txt":    "1\n3\n",
+	}, "third")
+
+	if status := doJSONRequest(t, http.MethodGet, ts.URL+"/git/stats/stats", nil, &response); status != 200 {
+		t.Fatalf("Expected status code 200, got %v", status)
+	}
+
+	stats := response.Stats
+
+	expectedContributors := []utils.Contributor{
+		{Name: "Jane Doe", Email: "jane@new.com", Commits: 2, Additions: 3, Deletions: 0},
+		{Name: "Test User", Email: "test@example.com", Commits: 1, Additions: 3, Deletions: 1},
+	}
+
+	if stats.TotalCommits != 3 || !reflect.DeepEqual(stats.Contributors, expectedContributors) {
+		t.Fatalf("Expected contributors merged by .mailmap, got %v", stats.Contributors)
+	}
+
+	expectedWeeks := []utils.WeeklyActivity{{Week: "2024-01-01", Commits: 1}, {Week: "2024-01-08", Commits: 2}}
+
+	if !reflect.DeepEqual(stats.WeeklyActivity, expectedWeeks) {
+		t.Fatalf("Expected weekly activity, got %v", stats.WeeklyActivity)
+	}
+
+	expectedHotFiles := []utils.FileActivity{{Path: "a.txt", Commits: 3}, {Path: ".mailmap", Commits: 1}, {Path: "b.txt", Commits: 1}}
+
+	if !reflect.DeepEqual(stats.HotFiles, expectedHotFiles) {
+		t.Fatalf("Expected hot files, got %v", stats.HotFiles)
+	}
+
+	pushTestCommit(t, "stats", "master", map[string]string{"c.txt": "c\n"}, "fourth")
+
+	var updated statsResponse
+
+	if status := doJSONRequest(t, http.MethodGet, ts.URL+"/git/stats/stats", nil, &updated); status != 200 ||
+		updated.Stats.TotalCommits != 4 || updated.Stats.Commit == stats.Commit {
+		t.Fatalf("Expected stats recomputed for new HEAD, got %v %v", status, updated.Stats)
+	}
+}
+
+func Test_RepoContentsAndCommitsEndpoints(t *testing.T) {
+	defer setupTestBaseDir(t)()
+
+	ts := httptest.NewServer(SetupServer())
+	defer ts.Close()
+
+	createTestRepo(t, ts.URL, "edit")
+
+	events := subscribeRepoEvents(t, "edit")
+
+	readPushEvent := func() models.MetadataInfo {
+		var event models.MetadataInfo
+
+		readRepoEvent(t, events, &event)
+
+		return event
+	}
+
+	type commitResponse struct {
+		Branch string `json:"branch"`
+		Commit string `json:"commit"`
+		OldSha string `json:"oldSha"`
+	}
+
+	var created commitResponse
+
+	if status := doJSONRequest(t, http.MethodPut, ts.URL+"/git/edit/contents/master/docs/README.md", ContentsUpdateRequest{
+		Content: "hello\n",
+		Message: "add readme",
+		OldSha:  strings.Repeat("0", 40),
+	}, &created); status != 201 || created.Branch != "master" {
+		t.Fatalf("Expected status code 201 creating master in empty repo, got %v %v", status, created)
+	}
+
+	if event := readPushEvent(); event.Type != models.MetaInfoType_Create || event.Ref != "refs/heads/master" || event.NewSha != created.Commit {
+		t.Fatalf("Expected create event of master, got %v", event)
+	}
+
+	if out, err := exec.Command("git", "-C", utils.GetRepoAbsolutePath("edit"), "branch", "feature/x", "master").CombinedOutput(); err != nil {
+		t.Fatalf("error, %v %s", err, out)
+	}
+
+	staleUpdate := ContentsUpdateRequest{Content: "stale\n", Message: "stale edit", OldSha: strings.Repeat("a", 40)}
+
+	if status := doJSONRequest(t, http.MethodPut, ts.URL+"/git/edit/contents/feature/x/docs/README.md", staleUpdate, nil); status != 409 {
+		t.Fatalf("Expected status code 409 for stale old sha, got %v", status)
+	}
+
+	var updated commitResponse
+
+	if status := doJSONRequest(t, http.MethodPut, ts.URL+"/git/edit/contents/feature/x/docs/README.md", ContentsUpdateRequest{
+		Content: "hello feature\n",
+		Message: "edit readme",
+		OldSha:  created.Commit,
+	}, &updated); status != 201 || updated.Branch != "feature/x" || updated.OldSha != created.Commit {
+		t.Fatalf("Expected status code 201 updating feature/x, got %v %v", status, updated)
+	}
+
+	if event := readPushEvent(); event.Type != models.MetaInfoType_Update || event.Ref != "refs/heads/feature/x" || event.OldSha != created.Commit {
+		t.Fatalf("Expected update event of feature/x, got %v", event)
+	}
+
+	var multiFile commitResponse
+
+	if status := doJSONRequest(t, http.MethodPost, ts.URL+"/git/edit/commits", utils.NewCommit{
+		Branch:  "master",
+		OldSha:  created.Commit,
+		Message: "replace readme with binary",
+		Author:  &utils.Author{Name: "Web Editor", Email: "web@example.com"},
+		Files: []utils.CommitFile{
+			{Path: "bin/data.bin", Content: base64.StdEncoding.EncodeToString([]byte{0, 1, 2}), Encoding: utils.FileEncoding_Base64},
+			{Path: "docs/README.md", Delete: true},
+		},
+	}, &multiFile); status != 201 || multiFile.OldSha != created.Commit {
+		t.Fatalf("Expected status code 201 for multi file commit, got %v %v", status, multiFile)
+	}
+
+	readPushEvent()
+
+	var commitDetail struct {
+		Commit utils.CommitDetail `json:"commit"`
+	}
+
+	doJSONRequest(t, http.MethodGet, ts.URL+"/git/edit/commit/master", nil, &commitDetail)
+
+	if commitDetail.Commit.Author.Email != "web@example.com" || commitDetail.Commit.Stats.FilesChanged != 2 || commitDetail.Commit.Parents[0] != created.Commit {
+		t.Fatalf("Expected commit by web editor changing 2 files, got %v", commitDetail.Commit)
+	}
+
+	resp, err := http.Get(ts.URL + "/git/edit/raw/master/bin/data.bin")
+	if err != nil {
+		t.Fatalf("error, %v", err)
+	}
+
+	content, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if !bytes.Equal(content, []byte{0, 1, 2}) {
+		t.Fatalf("Expected binary file content, got %v", content)
+	}
+
+	head := multiFile.Commit
+
+	for name, testCase := range map[string]struct {
+		commit         utils.NewCommit
+		expectedStatus int
+	}{
+		"missing branch":  {utils.NewCommit{Branch: "missing", Message: "m", OldSha: head, Files: []utils.CommitFile{{Path: "a.txt"}}}, 404},
+		"delete missing":  {utils.NewCommit{Branch: "master", Message: "m", OldSha: head, Files: []utils.CommitFile{{Path: "a.txt", Delete: true}}}, 404},
+		"git dir":         {utils.NewCommit{Branch: "master", Message: "m", OldSha: head, Files: []utils.CommitFile{{Path: "x/.GIT/config"}}}, 400},
+		"escaping path":   {utils.NewCommit{Branch: "master", Message: "m", OldSha: head, Files: []utils.CommitFile{{Path: "../a.txt"}}}, 400},
+		"directory":       {utils.NewCommit{Branch: "master", Message: "m", OldSha: head, Files: []utils.CommitFile{{Path: "bin"}}}, 400},
+		"file as parent":  {utils.NewCommit{Branch: "master", Message: "m", OldSha: head, Files: []utils.CommitFile{{Path: "bin/data.bin/x"}}}, 400},
+		"unchanged":       {utils.NewCommit{Branch: "master", Message: "m", OldSha: head, Files: []utils.CommitFile{{Path: "bin/data.bin", Content: "AAEC", Encoding: "base64"}}}, 400},
+		"file and dir":    {utils.NewCommit{Branch: "master", Message: "m", OldSha: head, Files: []utils.CommitFile{{Path: "d"}, {Path: "d/e/f"}}}, 400},
+		"duplicate path":  {utils.NewCommit{Branch: "master", Message: "m", OldSha: head, Files: []utils.CommitFile{{Path: "a"}, {Path: "/a"}}}, 400},
+		"bad encoding":    {utils.NewCommit{Branch: "master", Message: "m", OldSha: head, Files: []utils.CommitFile{{Path: "a", Content: "!", Encoding: "base64"}}}, 400},
+		"bad old sha":     {utils.NewCommit{Branch: "master", Message: "m", OldSha: "abc", Files: []utils.CommitFile{{Path: "a"}}}, 400},
+		"no files":        {utils.NewCommit{Branch: "master", Message: "m", OldSha: head, Files: []utils.CommitFile{}}, 400},
+		"invalid branch":  {utils.NewCommit{Branch: "a..b", Message: "m", OldSha: head, Files: []utils.CommitFile{{Path: "a"}}}, 400},
+		"missing old sha": {utils.NewCommit{Branch: "master", Message: "m", Files: []utils.CommitFile{{Path: "a"}}}, 400},
+		"stale old sha":   {utils.NewCommit{Branch: "master", Message: "m", OldSha: created.Commit, Files: []utils.CommitFile{{Path: "a"}}}, 409},
+		"null old sha":    {utils.NewCommit{Branch: "master", Message: "m", OldSha: strings.Repeat("0", 40), Files: []utils.CommitFile{{Path: "a"}}}, 409},
+	} {
+		if status := doJSONRequest(t, http.MethodPost, ts.URL+"/git/edit/commits", testCase.commit, nil); status != testCase.expectedStatus {
+			t.Fatalf("Expected status code %v for %s, got %v", testCase.expectedStatus, name, status)
+		}
+	}
+
+	if status := doJSONRequest(t, http.MethodPut, ts.URL+"/git/edit/contents/master/a.txt", ContentsUpdateRequest{Message: "m"}, nil); status != 400 {
+		t.Fatalf("Expected status code 400 without old sha, got %v", status)
+	}
+
+	if status := doJSONRequest(t, http.MethodPut, ts.URL+"/git/edit/contents/missing/a.txt", ContentsUpdateRequest{Message: "m", OldSha: head}, nil); status != 404 {
+		t.Fatalf("Expected status code 404 for missing branch, got %v", status)
+	}
+}
+
+func Test_RepoBranchAndTagRefEndpoints(t *testing.T) {
+	defer setupTestBaseDir(t)()
+
+	ts := httptest.NewServer(SetupServer())
+	defer ts.Close()
+
+	createTestRepo(t, ts.URL, "refs")
+	pushTestCommit(t, "refs", "master", map[string]string{"a.txt": "a\n"}, "first")
+	pushTestCommit(t, "refs", "master", map[string]string{"a.txt": "b\n"}, "second")
+
+	revParse := func(rev string) string {
+		out, err := exec.Command("git", "-C", utils.GetRepoAbsolutePath("refs"), "rev-parse", rev).CombinedOutput()
+		if err != nil {
+			t.Fatalf("error, %v %s", err, out)
+		}
+
+		return strings.TrimSpace(string(out))
+	}
+
+	first, second := revParse("master~1"), revParse("master")
+
+	events := subscribeRepoEvents(t, "refs")
+
+	readRefEvent := func() models.MetadataInfo {
+		var event models.MetadataInfo
+
+		readRepoEvent(t, events, &event)
+
+		return event
+	}
+
+	type refResponse struct {
+		Ref    string `json:"ref"`
+		NewSha string `json:"newSha"`
+	}
+
+	nullSha := strings.Repeat("0", 40)
+
+	var branch refResponse
+
+	if status := doJSONRequest(t, http.MethodPost, ts.URL+"/git/refs/branches", utils.NewRef{
+		Name:   "feature/x",
+		Target: "master~1",
+		OldSha: nullSha,
+	}, &branch); status != 201 || branch.Ref != "refs/heads/feature/x" || branch.NewSha != first {
+		t.Fatalf("Expected status code 201 creating branch from ref, got %v %v", status, branch)
+	}
+
+	if event := readRefEvent(); event.Type != models.MetaInfoType_Create || event.Ref != "refs/heads/feature/x" || event.NewSha != first {
+		t.Fatalf("Expected create event of feature/x, got %v", event)
+	}
+
+	if status := doJSONRequest(t, http.MethodPost, ts.URL+"/git/refs/branches", utils.NewRef{
+		Name:   "feature/x",
+		Target: second,
+		OldSha: nullSha,
+	}, nil); status != 409 {
+		t.Fatalf("Expected status code 409 for existing branch, got %v", status)
+	}
+
+	if status := doJSONRequest(t, http.MethodPost, ts.URL+"/git/refs/branches", utils.NewRef{
+		Name:   "other",
+		Target: second,
+	}, nil); status != 400 {
+		t.Fatalf("Expected status code 400 for new branch without old sha, got %v", status)
+	}
+
+	if status := doJSONRequest(t, http.MethodPost, ts.URL+"/git/refs/branches", utils.NewRef{
+		Name:   "other",
+		Target: second,
+		OldSha: first,
+	}, nil); status != 400 {
+		t.Fatalf("Expected status code 400 for new branch expected at a commit, got %v", status)
+	}
+
+	if status := doJSONRequest(t, http.MethodPost, ts.URL+"/git/refs/branches", utils.NewRef{
+		Name:   "bad..name",
+		Target: second,
+		OldSha: nullSha,
+	}, nil); status != 400 {
+		t.Fatalf("Expected status code 400 for invalid branch name, got %v", status)
+	}
+
+	if status := doJSONRequest(t, http.MethodPost, ts.URL+"/git/refs/branches", utils.NewRef{
+		Name:   "other",
+		Target: "missing",
+		OldSha: nullSha,
+	}, nil); status != 404 {
+		t.Fatalf("Expected status code 404 for missing target, got %v", status)
+	}
+
+	var lightweight refResponse
+
+	if status := doJSONRequest(t, http.MethodPost, ts.URL+"/git/refs/tags", utils.NewRef{
+		Name:   "v1",
+		Target: first,
+		OldSha: nullSha,
+	}, &lightweight); status != 201 || lightweight.NewSha != first {
+		t.Fatalf("Expected status code 201 creating lightweight tag, got %v %v", status, lightweight)
+	}
+
+	if event := readRefEvent(); event.Type != models.MetaInfoType_Create || event.Ref != "refs/tags/v1" {
+		t.Fatalf("Expected create event of v1, got %v", event)
+	}
+
+	if status := doJSONRequest(t, http.MethodPost, ts.URL+"/git/refs/tags", utils.NewRef{
+		Name:    "v1",
+		Target:  second,
+		OldSha:  nullSha,
+		Message: "annotated over lightweight",
+	}, nil); status != 409 {
+		t.Fatalf("Expected status code 409 for existing tag, got %v", status)
+	}
+
+	var annotated refResponse
+
+	if status := doJSONRequest(t, http.MethodPost, ts.URL+"/git/refs/tags", utils.NewRef{
+		Name:    "v2",
+		Target:  "master",
+		OldSha:  nullSha,
+		Message: "release v2",
+		Tagger:  &utils.Author{Name: "Releaser", Email: "release@example.com"},
+	}, &annotated); status != 201 || annotated.NewSha == second {
+		t.Fatalf("Expected status code 201 creating annotated tag object, got %v %v", status, annotated)
+	}
+
+	if event := readRefEvent(); event.Type != models.MetaInfoType_Create || event.NewSha != annotated.NewSha {
+		t.Fatalf("Expected create event of v2, got %v", event)
+	}
+
+	tags, total, err := utils.ListTags("refs", 1, 10)
+	if err != nil || total != 2 {
+		t.Fatalf("Expected two tags, got %v %v", total, err)
+	}
+
+	for _, tag := range tags {
+		if tag.Name == "v2" && (!tag.Annotated || tag.Target != second || tag.Message != "release v2" || tag.Tagger.Name != "Releaser") {
+			t.Fatalf("Expected annotated tag v2 of second commit, got %+v", tag)
+		}
+	}
+
+	if status := doJSONRequest(t, http.MethodDelete, ts.URL+"/git/refs/branches/feature/x", RefDeleteRequest{OldSha: second}, nil); status != 409 {
+		t.Fatalf("Expected status code 409 for stale old sha, got %v", status)
+	}
+
+	if status := doJSONRequest(t, http.MethodDelete, ts.URL+"/git/refs/branches/feature/x", RefDeleteRequest{OldSha: "master"}, nil); status != 400 {
+		t.Fatalf("Expected status code 400 for old sha which is not a sha, got %v", status)
+	}
+
+	if status := doJSONRequest(t, http.MethodDelete, ts.URL+"/git/refs/branches/feature/x", RefDeleteRequest{OldSha: first}, nil); status != 200 {
+		t.Fatalf("Expected status code 200 deleting branch, got %v", status)
+	}
+
+	if event := readRefEvent(); event.Type != models.MetaInfoType_Delete || event.Ref != "refs/heads/feature/x" || event.OldSha != first {
+		t.Fatalf("Expected delete event of feature/x, got %v", event)
+	}
+
+	if status := doJSONRequest(t, http.MethodDelete, ts.URL+"/git/refs/branches/feature/x", RefDeleteRequest{OldSha: first}, nil); status != 404 {
+		t.Fatalf("Expected status code 404 for deleted branch, got %v", status)
+	}
+
+	if status := doJSONRequest(t, http.MethodDelete, ts.URL+"/git/refs/branches/master", RefDeleteRequest{OldSha: second}, nil); status != 400 {
+		t.Fatalf("Expected status code 400 deleting default branch, got %v", status)
+	}
+
+	if status := doJSONRequest(t, http.MethodDelete, ts.URL+"/git/refs/tags/v2", RefDeleteRequest{OldSha: annotated.NewSha}, nil); status != 200 {
+		t.Fatalf("Expected status code 200 deleting tag, got %v", status)
+	}
+
+	if event := readRefEvent(); event.Type != models.MetaInfoType_Delete || event.Ref != "refs/tags/v2" {
+		t.Fatalf("Expected delete event of v2, got %v", event)
+	}
+}
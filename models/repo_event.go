@@ -0,0 +1,28 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+const (
+	RepoEventType_Delete        string = "REPO_DELETE"
+	RepoEventType_Rename        string = "REPO_RENAME"
+	RepoEventType_DefaultBranch string = "DEFAULT_BRANCH"
+)
+
+// RepoEvent repo level change format, sent for changes not caused by a push
+type RepoEvent struct {
+	Type     string `json:"type"`
+	RepoName string `json:"repoName"`
+	Old      string `json:"old,omitempty"`
+	New      string `json:"new,omitempty"`
+}
+
+// Bytes return the struct as bytes array
+func (event *RepoEvent) Bytes() []byte {
+	byteBuffer := new(bytes.Buffer)
+	_ = json.NewEncoder(byteBuffer).Encode(event)
+
+	return byteBuffer.Bytes()
+}
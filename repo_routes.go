@@ -0,0 +1,533 @@
+package main
+
+import (
+	"errors"
+	"gitbox/config"
+	"gitbox/hub"
+	"gitbox/models"
+	"gitbox/utils"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RepoUpdateRequest structure of update request, repo is renamed when name is given
+type RepoUpdateRequest struct {
+	RepoName string `json:"name"`
+	utils.RepoMetadataUpdate
+}
+
+// RepoForkRequest structure of fork request
+type RepoForkRequest struct {
+	RepoName string `json:"name" binding:"required"`
+}
+
+// DefaultBranchRequest structure of default branch change request
+type DefaultBranchRequest struct {
+	Branch string `json:"branch" binding:"required"`
+}
+
+// getExistingRepoName read repo name from url and respond with 404 if no such repo exists
+func getExistingRepoName(c *gin.Context) (string, bool) {
+	repoName := c.Params.ByName("name")
+
+	if repoNameValid := utils.IsRepoNameValid(repoName); !repoNameValid {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status": false,
+			"error":  "invalid repo name",
+		})
+		return "", false
+	}
+
+	if !utils.RepoExists(repoName) {
+		c.JSON(http.StatusNotFound, gin.H{
+			"status": false,
+			"error":  "repo not found",
+		})
+		return "", false
+	}
+
+	return repoName, true
+}
+
+// addRepoRoutes Setup routes managing a single repo, a catch all action is used
+// as namespaced repo names span over two path segments
+func addRepoRoutes(repoOps *gin.RouterGroup) {
+	// repos can be imported into an owner which has no repos yet
+	repoOps.Use(resolveRepoNamespace("name", true))
+
+	handleRepoAction := func(c *gin.Context) {
+		action := c.Param("action")
+
+		switch {
+		case action == "/" && c.Request.Method == http.MethodGet:
+			getRepo(c)
+		case action == "/" && c.Request.Method == http.MethodPatch:
+			updateRepo(c)
+		case action == "/" && c.Request.Method == http.MethodDelete:
+			deleteRepo(c)
+		case action == "/default-branch" && c.Request.Method == http.MethodPut:
+			setDefaultBranch(c)
+		case action == "/fork" && c.Request.Method == http.MethodPost:
+			forkRepo(c)
+		case action == "/import" && c.Request.Method == http.MethodPost:
+			importRepo(c)
+		default:
+			c.JSON(http.StatusNotFound, gin.H{
+				"status": false,
+				"error":  "not found",
+			})
+		}
+	}
+
+	repoOps.Any("", handleRepoAction)
+	repoOps.Any("/*action", handleRepoAction)
+}
+
+// listRepos list repos with their summary, supports paging and sorting
+func listRepos(c *gin.Context) {
+	pageNum, err := strconv.ParseInt(c.DefaultQuery("page", "0"), 10, 64)
+
+	if err != nil || pageNum < 0 {
+		pageNum = 0
+	}
+
+	perPage := utils.ParsePerPage(c.Query("per_page"), config.PerPageRepoCount, config.MaxPerPageRepoCount)
+	sortBy := c.DefaultQuery("sort", utils.RepoSortBy_Name)
+
+	if !utils.IsRepoSortByValid(sortBy) {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"status": false,
+			"error":  "sort can only be one of name, created or pushed",
+		})
+		return
+	}
+
+	repos, total, err := utils.ListRepos(sortBy, c.Query("order") == "desc", pageNum, perPage)
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status": false,
+			"error":  err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":  true,
+		"repos":   repos,
+		"page":    pageNum,
+		"perPage": perPage,
+		"total":   total,
+	})
+}
+
+// deleteRepo move the repo to trash and disconnect all its websocket clients
+func deleteRepo(c *gin.Context) {
+	repoName, ok := getExistingRepoName(c)
+	if !ok {
+		return
+	}
+
+	trashItem, err := utils.MoveRepoToTrash(repoName)
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status": false,
+			"error":  err.Error(),
+		})
+		return
+	}
+
+	deleteEvent := &models.RepoEvent{
+		Type:     models.RepoEventType_Delete,
+		RepoName: repoName,
+	}
+	hub.SuperHubInstance.RemoveHub(repoName, deleteEvent.Bytes())
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": true,
+		"trash":  trashItem,
+	})
+}
+
+// getRepo show summary and metadata of the repo
+func getRepo(c *gin.Context) {
+	repoName, ok := getExistingRepoName(c)
+	if !ok {
+		return
+	}
+
+	summary, err := utils.GetRepoSummary(repoName)
+
+	if err == nil {
+		summary.Forks, err = utils.GetRepoForks(repoName)
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"status": false,
+			"error":  err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status": true,
+		"repo":   summary,
+	})
+}
+
+// updateRepo update the repo metadata, and when a new name is given rename the repo
+// and move its websocket subscribers to the new name
+func updateRepo(c *gin.Context) {
+	repoName, ok := getExistingRepoName(c)
+	if !ok {
+		return
+	}
+
+	var request RepoUpdateRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   err.Error(),
+			"message": "Only JSON requests are allowed",
+		})
+		return
+	}
+
+	newRepoName := repoName
+	if request.RepoName != "" {
+		newRepoName = request.RepoName
+	}
+
+	if repoNameValid := utils.IsRepoNameValid(newRepoName); !repoNameValid {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": invalidRepoNameMessage,
+		})
+		return
+	}
+
+	if err := request.RepoMetadataUpdate.Validate(newRepoName); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if newRepoName != repoName {
+		if err := utils.CheckRepoExists(newRepoName); err != nil {
+			c.JSON(http.StatusConflict, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		if err := utils.RenameRepo(repoName, newRepoName); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"error": err.Error(),
+			})
+			return
+		}
+
+		if config.RENAME_REDIRECT_TTL > 0 {
+			utils.AddRepoRedirect(repoName, newRepoName, config.RENAME_REDIRECT_TTL)
+		}
+
+		renameEvent := &models.RepoEvent{
+			Type:     models.RepoEventType_Rename,
+			RepoName: newRepoName,
+			Old:      repoName,
+			New:      newRepoName,
+		}
+		hub.SuperHubInstance.RenameHub(repoName, newRepoName, renameEvent.Bytes())
+	}
+
+	metadata, err := utils.UpdateRepoMetadata(newRepoName, &request.RepoMetadataUpdate)
+
+	// the rename has already happened and been broadcast, so report it as done
+	// along with why the metadata could not be updated
+	if err != nil && newRepoName != repoName {
+		c.JSON(http.StatusOK, gin.H{
+			"status":   true,
+			"repoName": newRepoName,
+			"error":    err.Error(),
+		})
+		return
+	}
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":   true,
+		"repoName": newRepoName,
+		"metadata": metadata,
+	})
+}
+
+// setDefaultBranch point HEAD of the repo to another branch and notify the subscribers
+func setDefaultBranch(c *gin.Context) {
+	repoName, ok := getExistingRepoName(c)
+	if !ok {
+		return
+	}
+
+	var request DefaultBranchRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   err.Error(),
+			"message": "Only JSON requests are allowed",
+		})
+		return
+	}
+
+	oldBranch, err := utils.SetDefaultBranch(repoName, request.Branch)
+
+	switch {
+	case errors.Is(err, utils.ErrInvalidBranchName):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+		return
+	case errors.Is(err, utils.ErrRefNotFound):
+		c.JSON(http.StatusNotFound, gin.H{
+			"error": "branch not found",
+		})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if oldBranch != request.Branch {
+		defaultBranchEvent := &models.RepoEvent{
+			Type:     models.RepoEventType_DefaultBranch,
+			RepoName: repoName,
+			Old:      oldBranch,
+			New:      request.Branch,
+		}
+		hub.SuperHubInstance.SendEventToRepo(repoName, defaultBranchEvent.Bytes())
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":        true,
+		"defaultBranch": request.Branch,
+	})
+}
+
+// forkRepo create a new repo sharing objects with the existing repo
+func forkRepo(c *gin.Context) {
+	repoName, ok := getExistingRepoName(c)
+	if !ok {
+		return
+	}
+
+	var request RepoForkRequest
+
+	if err := c.ShouldBindJSON(&request); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   err.Error(),
+			"message": "Only JSON requests are allowed",
+		})
+		return
+	}
+
+	if repoNameValid := utils.IsRepoNameValid(request.RepoName); !repoNameValid {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": invalidRepoNameMessage,
+		})
+		return
+	}
+
+	if err := utils.CheckRepoExists(request.RepoName); err != nil {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	if err := utils.ForkRepo(repoName, request.RepoName); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	utils.RemoveRepoRedirect(request.RepoName)
+
+	c.JSON(http.StatusOK, gin.H{
+		"status":   true,
+		"repoName": request.RepoName,
+		"parent":   repoName,
+	})
+}
+
+// importRepo create a new repo from the git bundle uploaded in bundle form field
+func importRepo(c *gin.Context) {
+	repoName := c.Params.ByName("name")
+
+	if repoNameValid := utils.IsRepoNameValid(repoName); !repoNameValid {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": invalidRepoNameMessage,
+		})
+		return
+	}
+
+	if err := utils.CheckRepoExists(repoName); err != nil {
+		c.JSON(http.StatusConflict, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	bundleFile, err := c.FormFile("bundle")
+
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":   err.Error(),
+			"message": "git bundle should be uploaded in bundle field",
+		})
+		return
+	}
+
+	tempBundle, err := ioutil.TempFile("", "gitbox-import-*.bundle")
+
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	_ = tempBundle.Close()
+	defer os.Remove(tempBundle.Name())
+
+	if err := c.SaveUploadedFile(bundleFile, tempBundle.Name()); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+		return
+	}
+
+	bundleRefs, err := utils.ImportRepoFromBundle(repoName, tempBundle.Name())
+
+	switch {
+	case errors.Is(err, utils.ErrInvalidBundle):
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error": err.Error(),
+		})
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{
+			"error": err.Error(),
+		})
+	default:
+		utils.RemoveRepoRedirect(repoName)
+
+		c.JSON(http.StatusOK, gin.H{
+			"status":   true,
+			"repoName": repoName,
+			"refs":     bundleRefs,
+		})
+	}
+}
+
+// addTrashRoutes Setup routes to list, restore and purge deleted repos
+func addTrashRoutes(trash *gin.RouterGroup) {
+	trash.GET("", func(c *gin.Context) {
+		trashItems, err := utils.ListTrash()
+
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status": false,
+				"error":  err.Error(),
+			})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"status": true,
+			"trash":  trashItems,
+		})
+	})
+
+	trash.POST("/:id/restore", func(c *gin.Context) {
+		trashItem, err := utils.RestoreRepoFromTrash(c.Params.ByName("id"))
+
+		switch {
+		case errors.Is(err, utils.ErrTrashItemNotFound):
+			c.JSON(http.StatusNotFound, gin.H{
+				"status": false,
+				"error":  err.Error(),
+			})
+		case errors.Is(err, utils.ErrRepoAlreadyExists), errors.Is(err, utils.ErrNamespaceTaken):
+			c.JSON(http.StatusConflict, gin.H{
+				"status": false,
+				"error":  err.Error(),
+			})
+		case err != nil:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status": false,
+				"error":  err.Error(),
+			})
+		default:
+			utils.RemoveRepoRedirect(trashItem.RepoName)
+
+			c.JSON(http.StatusOK, gin.H{
+				"status":   true,
+				"repoName": trashItem.RepoName,
+			})
+		}
+	})
+
+	trash.DELETE("/:id", func(c *gin.Context) {
+		err := utils.PurgeTrashItem(c.Params.ByName("id"))
+
+		switch {
+		case errors.Is(err, utils.ErrTrashItemNotFound):
+			c.JSON(http.StatusNotFound, gin.H{
+				"status": false,
+				"error":  err.Error(),
+			})
+		case err != nil:
+			c.JSON(http.StatusInternalServerError, gin.H{
+				"status": false,
+				"error":  err.Error(),
+			})
+		default:
+			c.JSON(http.StatusOK, gin.H{
+				"status": true,
+			})
+		}
+	})
+}
+
+// purgeExpiredTrash periodically remove repos which stayed in trash past the retention time
+func purgeExpiredTrash(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		purgedItems, err := utils.PurgeExpiredTrash()
+
+		if err != nil {
+			log.Printf("unable to purge trash %v", err)
+		}
+
+		for _, item := range purgedItems {
+			log.Printf("purged repo %s deleted at %v", item.RepoName, item.DeletedAt)
+		}
+	}
+}
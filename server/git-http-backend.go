@@ -281,7 +281,7 @@ func getInfoRefs(hr HandlerReq) {
 		args := []string{serviceName, "--stateless-rpc", "--advertise-refs", "."}
 		refs := gitCommand(dir, version, args...)
 
-		hdrNocache(w)
+		HdrNocache(w)
 		w.Header().Set("Content-Type", fmt.Sprintf("application/x-git-%s-advertisement", serviceName))
 		w.WriteHeader(http.StatusOK)
 
@@ -293,33 +293,33 @@ func getInfoRefs(hr HandlerReq) {
 		_, _ = w.Write(refs)
 	} else {
 		updateServerInfo(dir)
-		hdrNocache(w)
+		HdrNocache(w)
 		sendFile("text/plain; charset=utf-8", hr)
 	}
 }
 
 func getInfoPacks(hr HandlerReq) {
-	hdrCacheForever(hr.w)
+	HdrCacheForever(hr.w)
 	sendFile("text/plain; charset=utf-8", hr)
 }
 
 func getLooseObject(hr HandlerReq) {
-	hdrCacheForever(hr.w)
+	HdrCacheForever(hr.w)
 	sendFile("application/x-git-loose-object", hr)
 }
 
 func getPackFile(hr HandlerReq) {
-	hdrCacheForever(hr.w)
+	HdrCacheForever(hr.w)
 	sendFile("application/x-git-packed-objects", hr)
 }
 
 func getIdxFile(hr HandlerReq) {
-	hdrCacheForever(hr.w)
+	HdrCacheForever(hr.w)
 	sendFile("application/x-git-packed-objects-toc", hr)
 }
 
 func getTextFile(hr HandlerReq) {
-	hdrNocache(hr.w)
+	HdrNocache(hr.w)
 	sendFile("text/plain", hr)
 }
 
@@ -454,13 +454,15 @@ func packetWrite(str string) []byte {
 
 // Header writing functions
 
-func hdrNocache(w http.ResponseWriter) {
+// HdrNocache headers which stop clients and proxies from caching the response
+func HdrNocache(w http.ResponseWriter) {
 	w.Header().Set("Expires", "Fri, 01 Jan 1980 00:00:00 GMT")
 	w.Header().Set("Pragma", "no-cache")
 	w.Header().Set("Cache-Control", "no-cache, max-age=0, must-revalidate")
 }
 
-func hdrCacheForever(w http.ResponseWriter) {
+// HdrCacheForever headers which let clients and proxies cache an immutable response for a year
+func HdrCacheForever(w http.ResponseWriter) {
 	now := time.Now().Unix()
 	expires := now + 31536000
 	w.Header().Set("Date", fmt.Sprintf("%d", now))
@@ -0,0 +1,100 @@
+package utils
+
+import (
+	"errors"
+	"io"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// ErrUnknownArchiveFormat returned when the archive name does not end with a supported extension
+var ErrUnknownArchiveFormat = errors.New("archive should be .tar.gz or .zip")
+
+// ArchiveFormat git archive format and content type of an archive extension
+type ArchiveFormat struct {
+	Extension   string
+	Format      string
+	ContentType string
+}
+
+// ArchiveFormats supported archive formats
+var ArchiveFormats = []ArchiveFormat{
+	{Extension: ".tar.gz", Format: "tar.gz", ContentType: "application/gzip"},
+	{Extension: ".zip", Format: "zip", ContentType: "application/zip"},
+}
+
+// archivePrefixRegEx characters replaced in the prefix directory of an archive
+var archivePrefixRegEx = regexp.MustCompile(`[^a-zA-Z\-_0-9.]+`)
+
+// RepoArchive a commit, optionally limited to a directory, to be archived
+type RepoArchive struct {
+	Ref    string
+	Commit string
+	Path   string
+	Prefix string
+	Format ArchiveFormat
+}
+
+// IsImmutable archive was asked by full commit sha, so its content can never change
+func (archive *RepoArchive) IsImmutable() bool {
+	return strings.EqualFold(archive.Ref, archive.Commit)
+}
+
+// GetRepoArchive resolve "<ref>.<extension>" and the optional directory to archive,
+// the archive has a "<repo>-<ref>/" prefix directory
+func GetRepoArchive(repoName string, archiveName string, dirPath string) (*RepoArchive, error) {
+	repoAbsolutePath := GetRepoAbsolutePath(repoName)
+
+	archive := &RepoArchive{}
+
+	for _, format := range ArchiveFormats {
+		if strings.HasSuffix(archiveName, format.Extension) {
+			archive.Ref = strings.TrimSuffix(archiveName, format.Extension)
+			archive.Format = format
+			break
+		}
+	}
+
+	if archive.Format.Format == "" {
+		return nil, ErrUnknownArchiveFormat
+	}
+
+	commitSha, err := resolveCommit(repoAbsolutePath, archive.Ref)
+	if err != nil {
+		return nil, err
+	}
+
+	archive.Commit = commitSha
+
+	archive.Path, err = cleanTreePath(dirPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if archive.Path != "" {
+		objectType, err := getObjectType(repoAbsolutePath, &RefPath{Commit: commitSha, Path: archive.Path})
+		if err != nil {
+			return nil, err
+		}
+
+		if objectType != "tree" {
+			return nil, ErrNotADirectory
+		}
+	}
+
+	archive.Prefix = archivePrefixRegEx.ReplaceAllString(path.Base(repoName)+"-"+archive.Ref, "-")
+
+	return archive, nil
+}
+
+// OpenRepoArchive stream the archive, files marked export-ignore in .gitattributes are left out
+func OpenRepoArchive(repoName string, archive *RepoArchive) (io.ReadCloser, error) {
+	args := []string{"archive", "--format=" + archive.Format.Format, "--prefix=" + archive.Prefix + "/", archive.Commit}
+
+	if archive.Path != "" {
+		args = append(args, "--", archive.Path)
+	}
+
+	return startGitCommand(GetRepoAbsolutePath(repoName), args...)
+}
@@ -0,0 +1,180 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidLineRange returned when the blamed line range is outside the file
+var ErrInvalidLineRange = errors.New("invalid line range")
+
+// BlameRange consecutive lines of a file last changed by the same commit
+type BlameRange struct {
+	Commit    string   `json:"commit"`
+	Subject   string   `json:"subject"`
+	Author    Author   `json:"author"`
+	StartLine int      `json:"startLine"`
+	EndLine   int      `json:"endLine"`
+	Lines     []string `json:"lines"`
+}
+
+// blameCommitInfo commit headers which porcelain blame prints only on first occurrence of a commit
+type blameCommitInfo struct {
+	author  Author
+	subject string
+}
+
+// formatBlameTime unix time and "+hhmm" zone of porcelain blame as iso-strict date, like git log prints
+func formatBlameTime(unixTime string, zone string) string {
+	seconds, err := strconv.ParseInt(unixTime, 10, 64)
+	if err != nil {
+		return ""
+	}
+
+	location := time.UTC
+
+	if offset, err := strconv.Atoi(zone); err == nil && len(zone) == 5 {
+		if offset < 0 {
+			offset = -offset
+		}
+
+		offsetSeconds := (offset/100)*3600 + (offset%100)*60
+		if zone[0] == '-' {
+			offsetSeconds = -offsetSeconds
+		}
+
+		location = time.FixedZone(zone, offsetSeconds)
+	}
+
+	return time.Unix(seconds, 0).In(location).Format(time.RFC3339)
+}
+
+// parseBlamePorcelain group lines of porcelain blame output into ranges of the same commit
+func parseBlamePorcelain(out []byte) ([]BlameRange, error) {
+	ranges := []BlameRange{}
+	commits := make(map[string]*blameCommitInfo)
+
+	var currentSha string
+	var currentLine int
+
+	// author time and zone of the commit being read arrive on separate lines
+	var authorTime, authorZone string
+
+	for _, line := range strings.Split(strings.TrimSuffix(string(out), "\n"), "\n") {
+		if line == "" {
+			continue
+		}
+
+		if strings.HasPrefix(line, "\t") {
+			info := commits[currentSha]
+			if info == nil {
+				return nil, errors.New("cannot parse blame")
+			}
+
+			content := line[1:]
+			lastIndex := len(ranges) - 1
+
+			if lastIndex >= 0 && ranges[lastIndex].Commit == currentSha && ranges[lastIndex].EndLine == currentLine-1 {
+				ranges[lastIndex].EndLine = currentLine
+				ranges[lastIndex].Lines = append(ranges[lastIndex].Lines, content)
+				continue
+			}
+
+			ranges = append(ranges, BlameRange{
+				Commit:    currentSha,
+				Subject:   info.subject,
+				Author:    info.author,
+				StartLine: currentLine,
+				EndLine:   currentLine,
+				Lines:     []string{content},
+			})
+			continue
+		}
+
+		key, value := line, ""
+		if spaceIndex := strings.IndexByte(line, ' '); spaceIndex >= 0 {
+			key, value = line[:spaceIndex], line[spaceIndex+1:]
+		}
+
+		info := commits[currentSha]
+
+		switch {
+		case len(key) == 40 && strings.Trim(key, "0123456789abcdef") == "":
+			// "<sha> <original line> <final line> [<lines in group>]"
+			fields := strings.Fields(value)
+			if len(fields) < 2 {
+				return nil, errors.New("cannot parse blame")
+			}
+
+			finalLine, err := strconv.Atoi(fields[1])
+			if err != nil {
+				return nil, errors.New("cannot parse blame")
+			}
+
+			currentSha, currentLine = key, finalLine
+
+			if commits[currentSha] == nil {
+				authorTime, authorZone = "", ""
+				commits[currentSha] = &blameCommitInfo{}
+			}
+		case info == nil:
+			return nil, errors.New("cannot parse blame")
+		case key == "author":
+			info.author.Name = value
+		case key == "author-mail":
+			info.author.Email = strings.TrimSuffix(strings.TrimPrefix(value, "<"), ">")
+		case key == "author-time":
+			authorTime = value
+		case key == "author-tz":
+			authorZone = value
+		case key == "summary":
+			info.subject = value
+		}
+
+		if key == "author-time" || key == "author-tz" {
+			info.author.Date = formatBlameTime(authorTime, authorZone)
+		}
+	}
+
+	return ranges, nil
+}
+
+// GetBlame blame the file at the path in the commit, when startLine is more than 0 only
+// lines from startLine to endLine are blamed, an endLine of 0 means till the end of file
+func GetBlame(repoName string, refPath *RefPath, startLine int, endLine int) ([]BlameRange, error) {
+	if _, err := GetBlobInfo(repoName, refPath); err != nil {
+		return nil, err
+	}
+
+	args := []string{"blame", "--porcelain"}
+
+	if startLine > 0 || endLine > 0 {
+		if startLine < 1 || (endLine > 0 && endLine < startLine) {
+			return nil, ErrInvalidLineRange
+		}
+
+		lineRange := fmt.Sprintf("%d,", startLine)
+		if endLine > 0 {
+			lineRange += strconv.Itoa(endLine)
+		}
+
+		args = append(args, "-L", lineRange)
+	}
+
+	args = append(args, refPath.Commit, "--", refPath.Path)
+
+	out, err := runGitCommand(GetRepoAbsolutePath(repoName), args...)
+	if err != nil {
+		// git refuses ranges starting after the last line of the file
+		if startLine > 0 && strings.Contains(err.Error(), "has only") {
+			return nil, fmt.Errorf("%w: file has fewer than %d lines", ErrInvalidLineRange, startLine)
+		}
+
+		return nil, err
+	}
+
+	return parseBlamePorcelain(out)
+}
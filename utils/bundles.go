@@ -0,0 +1,217 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// ErrEmptyRepo returned when an operation needs at least one commit in the repo
+var ErrEmptyRepo = errors.New("repo is empty")
+
+// ErrInvalidBundle returned when the uploaded bundle cannot be imported
+var ErrInvalidBundle = errors.New("invalid git bundle")
+
+// ErrEmptyBundleRange returned when a since..until range has no commits to bundle
+var ErrEmptyBundleRange = errors.New("no commits to bundle in range")
+
+// BundleRef a single ref present in a git bundle
+type BundleRef struct {
+	Sha string `json:"sha"`
+	Ref string `json:"ref"`
+}
+
+// listBundleRefs list the refs the bundle contains, HEAD is listed as well if present
+func listBundleRefs(repoAbsolutePath string, bundlePath string) ([]BundleRef, error) {
+	out, err := runGitCommand(repoAbsolutePath, "bundle", "list-heads", bundlePath)
+	if err != nil {
+		return nil, err
+	}
+
+	bundleRefs := []BundleRef{}
+
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		refPieces := strings.SplitN(line, " ", 2)
+		if len(refPieces) != 2 {
+			continue
+		}
+
+		bundleRefs = append(bundleRefs, BundleRef{Sha: refPieces[0], Ref: refPieces[1]})
+	}
+
+	return bundleRefs, nil
+}
+
+// getBundleHeadBranch the branch which HEAD of the bundle pointed to, empty if unknown
+func getBundleHeadBranch(bundleRefs []BundleRef) string {
+	headSha := ""
+
+	for _, bundleRef := range bundleRefs {
+		if bundleRef.Ref == "HEAD" {
+			headSha = bundleRef.Sha
+		}
+	}
+
+	for _, bundleRef := range bundleRefs {
+		if headSha != "" && bundleRef.Sha == headSha && strings.HasPrefix(bundleRef.Ref, "refs/heads/") {
+			return bundleRef.Ref
+		}
+	}
+
+	return ""
+}
+
+// ImportRepoFromBundle create a new repo populated with all refs of the bundle,
+// the repo is removed again if the bundle is invalid or misses prerequisite commits
+func ImportRepoFromBundle(repoName string, bundlePath string) ([]BundleRef, error) {
+	bundleAbsolutePath, err := filepath.Abs(bundlePath)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := CreateNewRepo(repoName); err != nil {
+		return nil, err
+	}
+
+	repoAbsolutePath := GetRepoAbsolutePath(repoName)
+
+	bundleRefs, err := importBundle(repoAbsolutePath, bundleAbsolutePath)
+	if err != nil {
+		_ = RemoveRepo(repoName)
+
+		return nil, err
+	}
+
+	return bundleRefs, nil
+}
+
+func importBundle(repoAbsolutePath string, bundlePath string) ([]BundleRef, error) {
+	// verify fails for corrupt bundles and for bundles depending on commits the repo does not have
+	if _, err := runGitCommand(repoAbsolutePath, "bundle", "verify", "--quiet", bundlePath); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidBundle, err)
+	}
+
+	bundleRefs, err := listBundleRefs(repoAbsolutePath, bundlePath)
+	if err != nil {
+		return nil, err
+	}
+
+	// verify only reads the bundle header, a truncated or corrupt pack fails while fetching it
+	if _, err := runGitCommand(repoAbsolutePath, "fetch", "--quiet", bundlePath, "+refs/*:refs/*"); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidBundle, err)
+	}
+
+	// a bundle of HEAD alone has no ref the fetch above could bring in
+	if !hasBundleRefs(bundleRefs) {
+		return bundleRefs, importBundleHead(repoAbsolutePath, bundlePath, bundleRefs)
+	}
+
+	if headBranch := getBundleHeadBranch(bundleRefs); headBranch != "" {
+		if _, err := runGitCommand(repoAbsolutePath, "symbolic-ref", "HEAD", headBranch); err != nil {
+			return nil, err
+		}
+	}
+
+	return bundleRefs, nil
+}
+
+// hasBundleRefs check if the bundle has any ref besides HEAD
+func hasBundleRefs(bundleRefs []BundleRef) bool {
+	for _, bundleRef := range bundleRefs {
+		if strings.HasPrefix(bundleRef.Ref, "refs/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// importBundleHead fetch HEAD of the bundle into the default branch of the repo
+func importBundleHead(repoAbsolutePath string, bundlePath string, bundleRefs []BundleRef) error {
+	hasHead := false
+
+	for _, bundleRef := range bundleRefs {
+		hasHead = hasHead || bundleRef.Ref == "HEAD"
+	}
+
+	if !hasHead {
+		return fmt.Errorf("%w: bundle has no refs", ErrInvalidBundle)
+	}
+
+	defaultBranch, err := runGitCommand(repoAbsolutePath, "symbolic-ref", "HEAD")
+	if err != nil {
+		return err
+	}
+
+	refspec := "HEAD:" + strings.TrimSpace(string(defaultBranch))
+
+	if _, err := runGitCommand(repoAbsolutePath, "fetch", "--quiet", bundlePath, refspec); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidBundle, err)
+	}
+
+	return nil
+}
+
+// GetBundleRevs rev-list arguments for bundling the whole repo, a single branch or tag,
+// or a since..until range where until has to be a branch or tag
+func GetBundleRevs(repoName string, ref string) ([]string, error) {
+	repoAbsolutePath := GetRepoAbsolutePath(repoName)
+
+	isEmpty, err := isRepoEmpty(repoAbsolutePath)
+	if err != nil {
+		return nil, err
+	}
+
+	if isEmpty {
+		return nil, ErrEmptyRepo
+	}
+
+	if ref == "" {
+		return []string{"--all"}, nil
+	}
+
+	since, until := "", ref
+
+	if rangePieces := strings.SplitN(ref, "..", 2); len(rangePieces) == 2 {
+		since, until = rangePieces[0], rangePieces[1]
+	}
+
+	// a bundle can only carry named refs, so a bare sha cannot be the tip
+	untilRef, err := resolveFullRefName(repoAbsolutePath, until)
+	if err != nil {
+		return nil, err
+	}
+
+	if since == "" {
+		return []string{untilRef}, nil
+	}
+
+	sinceSha, err := resolveCommit(repoAbsolutePath, since)
+	if err != nil {
+		return nil, err
+	}
+
+	revs := []string{"^" + sinceSha, untilRef}
+
+	// git refuses to create an empty bundle only after the response has started streaming
+	count, err := runGitCommand(repoAbsolutePath, append([]string{"rev-list", "--count"}, revs...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	if strings.TrimSpace(string(count)) == "0" {
+		return nil, fmt.Errorf("%w: %s", ErrEmptyBundleRange, ref)
+	}
+
+	return revs, nil
+}
+
+// OpenRepoBundle start creating a git bundle of the given revs, the bundle is streamed
+// through the returned reader which has to be closed once done
+func OpenRepoBundle(repoName string, revs []string) (io.ReadCloser, error) {
+	args := append([]string{"bundle", "create", "--quiet", "-"}, revs...)
+
+	return startGitCommand(GetRepoAbsolutePath(repoName), args...)
+}
@@ -0,0 +1,361 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"gitbox/config"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	FileChangeStatus_Added       string = "added"
+	FileChangeStatus_Modified    string = "modified"
+	FileChangeStatus_Deleted     string = "deleted"
+	FileChangeStatus_Renamed     string = "renamed"
+	FileChangeStatus_Copied      string = "copied"
+	FileChangeStatus_TypeChanged string = "typechanged"
+)
+
+// FileChange change of a single file between two commits
+type FileChange struct {
+	Path      string `json:"path"`
+	OldPath   string `json:"oldPath,omitempty"`
+	Status    string `json:"status"`
+	Additions int    `json:"additions"`
+	Deletions int    `json:"deletions"`
+	Binary    bool   `json:"binary"`
+}
+
+// DiffStats totals of all file changes
+type DiffStats struct {
+	FilesChanged int `json:"filesChanged"`
+	Additions    int `json:"additions"`
+	Deletions    int `json:"deletions"`
+}
+
+// Diff file changes between two commits and optionally the unified patch
+type Diff struct {
+	Stats          DiffStats    `json:"stats"`
+	Files          []FileChange `json:"files"`
+	Patch          string       `json:"patch,omitempty"`
+	PatchTruncated bool         `json:"patchTruncated,omitempty"`
+}
+
+// CommitDetail a single commit with full message, parents and the changes it made
+type CommitDetail struct {
+	CommitItem
+	Tree    string   `json:"tree"`
+	Parents []string `json:"parents"`
+	Diff
+}
+
+// ErrNoMergeBase compared commits do not share any history
+var ErrNoMergeBase = errors.New("commits have no common ancestor")
+
+// ErrInvalidCompareRange compare range is not in "<base>...<head>" form
+var ErrInvalidCompareRange = errors.New("compare range should be <base>...<head>")
+
+// CompareResult commits and changes of head since it diverged from base
+type CompareResult struct {
+	Base             string       `json:"base"`
+	Head             string       `json:"head"`
+	MergeBase        string       `json:"mergeBase"`
+	AheadBy          int          `json:"aheadBy"`
+	BehindBy         int          `json:"behindBy"`
+	Commits          []CommitItem `json:"commits"`
+	CommitsTruncated bool         `json:"commitsTruncated,omitempty"`
+	Diff
+}
+
+// commitDetailFormat NUL separated commit fields, body is last as it can span multiple lines
+const commitDetailFormat string = "--format=%H%x00%T%x00%P%x00%aN%x00%aE%x00%ad%x00%cN%x00%cE%x00%cd%x00%s%x00%b"
+
+const commitDetailFieldsCount = 11
+
+var diffStatusNames = map[byte]string{
+	'A': FileChangeStatus_Added,
+	'M': FileChangeStatus_Modified,
+	'D': FileChangeStatus_Deleted,
+	'R': FileChangeStatus_Renamed,
+	'C': FileChangeStatus_Copied,
+	'T': FileChangeStatus_TypeChanged,
+}
+
+// getDiffArgs diff-tree arguments comparing fromSha to toSha, when fromSha is empty
+// toSha is compared to an empty tree, as done for root commits
+func getDiffArgs(fromSha string, toSha string, extraArgs ...string) []string {
+	args := append([]string{"diff-tree", "-r", "-M"}, extraArgs...)
+
+	if fromSha == "" {
+		return append(args, "--root", toSha)
+	}
+
+	return append(args, fromSha, toSha)
+}
+
+// GetDiff file changes from fromSha to toSha with line stats and renames detected,
+// the unified patch is added when withPatch is set
+func GetDiff(repoName string, fromSha string, toSha string, withPatch bool) (*Diff, error) {
+	repoAbsolutePath := GetRepoAbsolutePath(repoName)
+
+	nameStatus, err := runGitCommand(repoAbsolutePath, getDiffArgs(fromSha, toSha, "-z", "--no-commit-id", "--name-status")...)
+	if err != nil {
+		return nil, err
+	}
+
+	numStat, err := runGitCommand(repoAbsolutePath, getDiffArgs(fromSha, toSha, "-z", "--no-commit-id", "--numstat")...)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := &Diff{Files: parseNameStatus(string(nameStatus))}
+
+	if err := addNumStat(diff, string(numStat)); err != nil {
+		return nil, err
+	}
+
+	if withPatch {
+		patch, err := runGitCommand(repoAbsolutePath, getDiffArgs(fromSha, toSha, "--no-commit-id", "-p")...)
+		if err != nil {
+			return nil, err
+		}
+
+		diff.Patch, diff.PatchTruncated = truncatePatch(patch, config.MaxPatchSize)
+	}
+
+	return diff, nil
+}
+
+// truncatePatch cut the patch at maxSize bytes, backing up to the start of a rune so
+// a multi-byte character is not split in half
+func truncatePatch(patch []byte, maxSize int64) (string, bool) {
+	if int64(len(patch)) <= maxSize {
+		return string(patch), false
+	}
+
+	end := maxSize
+	for end > 0 && !utf8.RuneStart(patch[end]) {
+		end--
+	}
+
+	return string(patch[:end]), true
+}
+
+// parseNameStatus parse "<status>\0<path>\0" entries, renames and copies have
+// "<status><score>\0<old path>\0<new path>\0"
+func parseNameStatus(nameStatus string) []FileChange {
+	fields := strings.Split(strings.TrimSuffix(nameStatus, "\x00"), "\x00")
+	files := []FileChange{}
+
+	for i := 0; i+1 < len(fields); i += 2 {
+		if fields[i] == "" {
+			break
+		}
+
+		status := diffStatusNames[fields[i][0]]
+		fileChange := FileChange{Status: status, Path: fields[i+1]}
+
+		if (status == FileChangeStatus_Renamed || status == FileChangeStatus_Copied) && i+2 < len(fields) {
+			fileChange.OldPath = fields[i+1]
+			fileChange.Path = fields[i+2]
+			i++
+		}
+
+		files = append(files, fileChange)
+	}
+
+	return files
+}
+
+// addNumStat add line stats to the files from "<added>\t<deleted>\t<path>\0" entries, renames and
+// copies have "<added>\t<deleted>\t\0<old path>\0<new path>\0", binary files have "-" as counts
+func addNumStat(diff *Diff, numStat string) error {
+	fields := strings.Split(strings.TrimSuffix(numStat, "\x00"), "\x00")
+	fileIndex := 0
+
+	for i := 0; i < len(fields) && fields[i] != ""; i++ {
+		statPieces := strings.SplitN(fields[i], "\t", 3)
+		if len(statPieces) != 3 {
+			return errors.New("cannot parse diff stats")
+		}
+
+		// an empty path means the old and new paths of a rename follow
+		if statPieces[2] == "" {
+			i += 2
+		}
+
+		if fileIndex >= len(diff.Files) {
+			return errors.New("diff stats do not match changed files")
+		}
+
+		fileChange := &diff.Files[fileIndex]
+		fileIndex++
+
+		if statPieces[0] == "-" {
+			fileChange.Binary = true
+		} else {
+			fileChange.Additions, _ = strconv.Atoi(statPieces[0])
+			fileChange.Deletions, _ = strconv.Atoi(statPieces[1])
+		}
+
+		diff.Stats.Additions += fileChange.Additions
+		diff.Stats.Deletions += fileChange.Deletions
+	}
+
+	diff.Stats.FilesChanged = len(diff.Files)
+
+	return nil
+}
+
+// parseCommitFields build a commit from the fields printed with commitDetailFormat
+func parseCommitFields(fields []string) *CommitDetail {
+	return &CommitDetail{
+		CommitItem: CommitItem{
+			Commit:   fields[0],
+			Author:   Author{Name: fields[3], Email: fields[4], Date: fields[5]},
+			Commiter: CommiterType{Name: fields[6], Email: fields[7], Date: fields[8]},
+			Subject:  fields[9],
+			Body:     strings.TrimRight(fields[10], "\n"),
+		},
+		Tree:    fields[1],
+		Parents: strings.Fields(fields[2]),
+	}
+}
+
+// parseCommitDetail parse a commit printed with commitDetailFormat
+func parseCommitDetail(out string) (*CommitDetail, error) {
+	fields := strings.SplitN(out, "\x00", commitDetailFieldsCount)
+	if len(fields) != commitDetailFieldsCount {
+		return nil, errors.New("cannot parse commit")
+	}
+
+	return parseCommitFields(fields), nil
+}
+
+// parseCommitItems parse commits printed by git log -z with commitDetailFormat, commit messages
+// cannot contain NUL so every commit is exactly commitDetailFieldsCount fields
+func parseCommitItems(out string) ([]CommitItem, error) {
+	commits := []CommitItem{}
+
+	if out == "" {
+		return commits, nil
+	}
+
+	fields := strings.Split(strings.TrimSuffix(out, "\x00"), "\x00")
+	if len(fields)%commitDetailFieldsCount != 0 {
+		return nil, errors.New("cannot parse commits")
+	}
+
+	for i := 0; i < len(fields); i += commitDetailFieldsCount {
+		commits = append(commits, parseCommitFields(fields[i:i+commitDetailFieldsCount]).CommitItem)
+	}
+
+	return commits, nil
+}
+
+// GetCommitDetail full detail of a single commit, changes are compared to its first parent
+func GetCommitDetail(repoName string, rev string, withPatch bool) (*CommitDetail, error) {
+	repoAbsolutePath := GetRepoAbsolutePath(repoName)
+
+	commitSha, err := resolveCommit(repoAbsolutePath, rev)
+	if err != nil {
+		return nil, err
+	}
+
+	out, err := runGitCommand(repoAbsolutePath, "show", "-s", "--date=iso-strict", commitDetailFormat, commitSha)
+	if err != nil {
+		return nil, err
+	}
+
+	commit, err := parseCommitDetail(string(out))
+	if err != nil {
+		return nil, err
+	}
+
+	fromSha := ""
+	if len(commit.Parents) > 0 {
+		fromSha = commit.Parents[0]
+	}
+
+	diff, err := GetDiff(repoName, fromSha, commitSha, withPatch)
+	if err != nil {
+		return nil, err
+	}
+
+	commit.Diff = *diff
+
+	return commit, nil
+}
+
+// ParseCompareRange split "<base>...<head>" into base and head revs
+func ParseCompareRange(compareRange string) (string, string, error) {
+	separatorIndex := strings.Index(compareRange, "...")
+	if separatorIndex <= 0 || separatorIndex+3 >= len(compareRange) {
+		return "", "", ErrInvalidCompareRange
+	}
+
+	return compareRange[:separatorIndex], compareRange[separatorIndex+3:], nil
+}
+
+// CompareCommits compare head to base the way a pull request would, commits reachable from head
+// but not base and the changes from their merge base to head, newest commits first
+func CompareCommits(repoName string, baseRev string, headRev string, withPatch bool) (*CompareResult, error) {
+	repoAbsolutePath := GetRepoAbsolutePath(repoName)
+
+	baseSha, err := resolveCommit(repoAbsolutePath, baseRev)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", err, baseRev)
+	}
+
+	headSha, err := resolveCommit(repoAbsolutePath, headRev)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", err, headRev)
+	}
+
+	mergeBase, err := runGitCommand(repoAbsolutePath, "merge-base", baseSha, headSha)
+	if err != nil {
+		return nil, ErrNoMergeBase
+	}
+
+	counts, err := runGitCommand(repoAbsolutePath, "rev-list", "--left-right", "--count", baseSha+"..."+headSha)
+	if err != nil {
+		return nil, err
+	}
+
+	var behindBy, aheadBy int
+	if _, err := fmt.Sscanf(string(counts), "%d\t%d", &behindBy, &aheadBy); err != nil {
+		return nil, fmt.Errorf("cannot parse commit counts: %w", err)
+	}
+
+	out, err := runGitCommand(repoAbsolutePath, "log", "-z", "--date=iso-strict", commitDetailFormat,
+		fmt.Sprintf("--max-count=%d", config.MaxCompareCommits), baseSha+".."+headSha)
+	if err != nil {
+		return nil, err
+	}
+
+	commits, err := parseCommitItems(string(out))
+	if err != nil {
+		return nil, err
+	}
+
+	result := &CompareResult{
+		Base:             baseSha,
+		Head:             headSha,
+		MergeBase:        strings.TrimSpace(string(mergeBase)),
+		AheadBy:          aheadBy,
+		BehindBy:         behindBy,
+		Commits:          commits,
+		CommitsTruncated: aheadBy > len(commits),
+	}
+
+	diff, err := GetDiff(repoName, result.MergeBase, headSha, withPatch)
+	if err != nil {
+		return nil, err
+	}
+
+	result.Diff = *diff
+
+	return result, nil
+}
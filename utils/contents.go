@@ -0,0 +1,345 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"gitbox/models"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ErrRefChanged returned when a ref no longer points to the expected old sha
+var ErrRefChanged = errors.New("ref was updated since the expected old sha")
+
+// ErrInvalidCommit returned when a commit to be created has no message, no files or invalid files
+var ErrInvalidCommit = errors.New("invalid commit")
+
+// ErrNothingToCommit returned when the file changes leave the tree as it was
+var ErrNothingToCommit = errors.New("nothing to commit, files are unchanged")
+
+const (
+	FileEncoding_Text   string = "text"
+	FileEncoding_Base64 string = "base64"
+)
+
+// CommitFile a file to be written, or deleted when Delete is set
+type CommitFile struct {
+	Path     string `json:"path"`
+	Content  string `json:"content"`
+	Encoding string `json:"encoding"`
+	Delete   bool   `json:"delete"`
+}
+
+// NewCommit a commit to be created on top of a branch, OldSha is the commit the branch is expected
+// to point to, the null sha of all zeros is expected for the first commit of an empty repo
+type NewCommit struct {
+	Branch  string       `json:"branch" binding:"required"`
+	OldSha  string       `json:"oldSha" binding:"required"`
+	Message string       `json:"message" binding:"required"`
+	Author  *Author      `json:"author"`
+	Files   []CommitFile `json:"files" binding:"required"`
+}
+
+// indexEntry a file in the index with its mode
+type indexEntry struct {
+	mode string
+	path string
+}
+
+// Validate check the branch, message and files, and clean the file paths
+func (commit *NewCommit) Validate() error {
+	if !IsBranchNameValid(commit.Branch) {
+		return ErrInvalidBranchName
+	}
+
+	if strings.TrimSpace(commit.Message) == "" || len(commit.Files) == 0 {
+		return fmt.Errorf("%w: message and at least one file are required", ErrInvalidCommit)
+	}
+
+	if !isFullSha(commit.OldSha) {
+		return fmt.Errorf("%w: oldSha should be a full commit sha", ErrInvalidCommit)
+	}
+
+	seenPaths := make(map[string]bool)
+
+	for i := range commit.Files {
+		file := &commit.Files[i]
+
+		filePath, err := cleanTreePath(file.Path)
+		if err != nil || filePath == "" {
+			return fmt.Errorf("%w: invalid path %s", ErrInvalidCommit, file.Path)
+		}
+
+		for _, piece := range strings.Split(filePath, "/") {
+			if strings.EqualFold(piece, ".git") {
+				return fmt.Errorf("%w: invalid path %s", ErrInvalidCommit, file.Path)
+			}
+		}
+
+		if seenPaths[filePath] {
+			return fmt.Errorf("%w: %s is changed more than once", ErrInvalidCommit, filePath)
+		}
+
+		seenPaths[filePath] = true
+		file.Path = filePath
+
+		switch file.Encoding {
+		case "", FileEncoding_Text:
+		case FileEncoding_Base64:
+			if _, err := base64.StdEncoding.DecodeString(file.Content); err != nil {
+				return fmt.Errorf("%w: %s is not valid base64", ErrInvalidCommit, filePath)
+			}
+		default:
+			return fmt.Errorf("%w: encoding can only be text or base64", ErrInvalidCommit)
+		}
+	}
+
+	// the index silently keeps only one of a file and a file inside a directory of the same path
+	for filePath := range seenPaths {
+		for parent := path.Dir(filePath); parent != "."; parent = path.Dir(parent) {
+			if seenPaths[parent] {
+				return fmt.Errorf("%w: %s and %s cannot both be files", ErrInvalidCommit, parent, filePath)
+			}
+		}
+	}
+
+	return nil
+}
+
+// getContentBytes file content decoded from its encoding
+func (file *CommitFile) getContentBytes() []byte {
+	if file.Encoding == FileEncoding_Base64 {
+		content, _ := base64.StdEncoding.DecodeString(file.Content)
+		return content
+	}
+
+	return []byte(file.Content)
+}
+
+// getParentPaths "a", "a/b" for "a/b/c"
+func getParentPaths(filePath string) []string {
+	parents := []string{}
+
+	for i, char := range filePath {
+		if char == '/' {
+			parents = append(parents, filePath[:i])
+		}
+	}
+
+	return parents
+}
+
+// listIndexEntries entries of the index matching the paths or inside them
+func listIndexEntries(repoAbsolutePath string, env []string, paths []string) ([]indexEntry, error) {
+	args := append([]string{"--literal-pathspecs", "ls-files", "-s", "-z", "--"}, paths...)
+
+	out, err := runGitCommandWithInput(repoAbsolutePath, nil, env, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []indexEntry{}
+
+	for _, line := range strings.Split(strings.TrimSuffix(string(out), "\x00"), "\x00") {
+		// "<mode> <sha> <stage>\t<path>"
+		linePieces := strings.SplitN(line, "\t", 2)
+		if len(linePieces) != 2 {
+			continue
+		}
+
+		entries = append(entries, indexEntry{mode: strings.Fields(linePieces[0])[0], path: linePieces[1]})
+	}
+
+	return entries, nil
+}
+
+// getIndexInfo "<mode> <sha>\t<path>" input of update-index --index-info for the files, existing
+// files keep their mode, a path cannot turn a file into a directory or the other way around
+func getIndexInfo(repoAbsolutePath string, env []string, files []CommitFile) ([]byte, error) {
+	paths := []string{}
+
+	for _, file := range files {
+		paths = append(append(paths, file.Path), getParentPaths(file.Path)...)
+	}
+
+	entries, err := listIndexEntries(repoAbsolutePath, env, paths)
+	if err != nil {
+		return nil, err
+	}
+
+	var indexInfo bytes.Buffer
+
+	for _, file := range files {
+		mode := ""
+
+		for _, entry := range entries {
+			switch {
+			case entry.path == file.Path:
+				mode = entry.mode
+			case strings.HasPrefix(entry.path, file.Path+"/"):
+				return nil, fmt.Errorf("%w: %s", ErrNotAFile, file.Path)
+			case strings.HasPrefix(file.Path, entry.path+"/"):
+				return nil, fmt.Errorf("%w: %s", ErrNotADirectory, entry.path)
+			}
+		}
+
+		if file.Delete {
+			if mode == "" {
+				return nil, fmt.Errorf("%w: %s", ErrPathNotFound, file.Path)
+			}
+
+			fmt.Fprintf(&indexInfo, "0 %s\t%s\x00", nullSha, file.Path)
+			continue
+		}
+
+		// symlinks and submodules are replaced by a regular file
+		if mode != "100755" {
+			mode = "100644"
+		}
+
+		blobSha, err := writeBlob(repoAbsolutePath, file.getContentBytes())
+		if err != nil {
+			return nil, err
+		}
+
+		fmt.Fprintf(&indexInfo, "%s %s\t%s\x00", mode, blobSha, file.Path)
+	}
+
+	return indexInfo.Bytes(), nil
+}
+
+// writeCommitTree tree of the parent commit with the file changes applied, built in a temporary
+// index so the repo is never touched until the branch is updated
+func writeCommitTree(repoAbsolutePath string, parentSha string, files []CommitFile) (string, error) {
+	indexDir, err := ioutil.TempDir("", "gitbox-index")
+	if err != nil {
+		return "", err
+	}
+
+	defer os.RemoveAll(indexDir)
+
+	env := []string{"GIT_INDEX_FILE=" + filepath.Join(indexDir, "index")}
+
+	if parentSha != "" {
+		if _, err := runGitCommandWithInput(repoAbsolutePath, nil, env, "read-tree", parentSha); err != nil {
+			return "", err
+		}
+	}
+
+	indexInfo, err := getIndexInfo(repoAbsolutePath, env, files)
+	if err != nil {
+		return "", err
+	}
+
+	if _, err := runGitCommandWithInput(repoAbsolutePath, indexInfo, env, "update-index", "-z", "--index-info"); err != nil {
+		return "", err
+	}
+
+	treeSha, err := runGitCommandWithInput(repoAbsolutePath, nil, env, "write-tree")
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(treeSha)), nil
+}
+
+// CommitFiles create a commit with the file changes on top of the branch and move the branch to it
+// only if it still points to the expected old sha, in an empty repo the branch is created by the
+// commit, the returned event is the same a push of the commit would send
+func CommitFiles(repoName string, commit *NewCommit) (*models.MetadataInfo, error) {
+	repoAbsolutePath := GetRepoAbsolutePath(repoName)
+
+	if err := commit.Validate(); err != nil {
+		return nil, err
+	}
+
+	branchRef := "refs/heads/" + commit.Branch
+
+	parentSha, err := resolveCommit(repoAbsolutePath, branchRef)
+
+	switch {
+	case errors.Is(err, ErrRefNotFound):
+		isEmpty, emptyErr := isRepoEmpty(repoAbsolutePath)
+
+		switch {
+		case emptyErr != nil:
+			return nil, emptyErr
+		case !isEmpty:
+			return nil, fmt.Errorf("%w: %s", ErrRefNotFound, commit.Branch)
+		}
+
+		parentSha = ""
+	case err != nil:
+		return nil, err
+	}
+
+	expectedSha := commit.OldSha
+	if expectedSha == nullSha {
+		expectedSha = ""
+	}
+
+	if expectedSha != parentSha {
+		return nil, ErrRefChanged
+	}
+
+	treeSha, err := writeCommitTree(repoAbsolutePath, parentSha, commit.Files)
+	if err != nil {
+		return nil, err
+	}
+
+	parents := []string{}
+
+	if parentSha != "" {
+		parentTreeSha, err := runGitCommand(repoAbsolutePath, "rev-parse", parentSha+"^{tree}")
+		if err != nil {
+			return nil, err
+		}
+
+		if strings.TrimSpace(string(parentTreeSha)) == treeSha {
+			return nil, ErrNothingToCommit
+		}
+
+		parents = append(parents, parentSha)
+	}
+
+	commitSha, err := commitTree(repoAbsolutePath, treeSha, parents, commit.Message, commit.Author)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := updateRef(repoAbsolutePath, branchRef, commitSha, parentSha); err != nil {
+		if currentSha, _ := resolveCommit(repoAbsolutePath, branchRef); currentSha != parentSha {
+			return nil, ErrRefChanged
+		}
+
+		return nil, err
+	}
+
+	return NewRefUpdateEvent(branchRef, parentSha, commitSha), nil
+}
+
+// ResolveBranchPath split "branch/path" where the branch may itself contain slashes, the shortest
+// prefix which is an existing branch is used, in an empty repo the first piece names the new branch
+func ResolveBranchPath(repoName string, branchAndPath string) (string, string, error) {
+	repoAbsolutePath := GetRepoAbsolutePath(repoName)
+	pathPieces := strings.Split(strings.Trim(branchAndPath, "/"), "/")
+
+	for i := 1; i < len(pathPieces); i++ {
+		branch := strings.Join(pathPieces[:i], "/")
+
+		if _, err := runGitCommand(repoAbsolutePath, "show-ref", "--verify", "--quiet", "refs/heads/"+branch); err == nil {
+			return branch, strings.Join(pathPieces[i:], "/"), nil
+		}
+	}
+
+	if isEmpty, err := isRepoEmpty(repoAbsolutePath); err == nil && isEmpty && len(pathPieces) > 1 {
+		return pathPieces[0], strings.Join(pathPieces[1:], "/"), nil
+	}
+
+	return "", "", ErrRefNotFound
+}
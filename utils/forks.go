@@ -0,0 +1,173 @@
+package utils
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// parentConfigKey git config key in which forks made before the parent was kept in
+// metadata have the name of their parent repo
+const parentConfigKey string = "gitbox.parent"
+
+func getAlternatesPath(repoAbsolutePath string) string {
+	return path.Join(repoAbsolutePath, "objects", "info", "alternates")
+}
+
+// getObjectsAbsolutePath alternates are resolved from the repo dir, so they need an absolute path
+func getObjectsAbsolutePath(repoName string) (string, error) {
+	return filepath.Abs(path.Join(GetRepoAbsolutePath(repoName), "objects"))
+}
+
+// ForkRepo create a new bare repo with all refs of the parent repo,
+// objects are shared with the parent through alternates instead of being copied
+func ForkRepo(parentRepoName string, forkRepoName string) error {
+	if err := CheckRepoExists(forkRepoName); err != nil {
+		return err
+	}
+
+	parentAbsolutePath, err := filepath.Abs(GetRepoAbsolutePath(parentRepoName))
+	if err != nil {
+		return err
+	}
+
+	forkAbsolutePath := GetRepoAbsolutePath(forkRepoName)
+
+	if err := os.MkdirAll(path.Dir(forkAbsolutePath), 0700); err != nil {
+		return err
+	}
+
+	if _, err := runGitCommand(path.Dir(forkAbsolutePath), "clone", "--bare", "--shared", "--quiet", parentAbsolutePath, forkAbsolutePath); err != nil {
+		// remove whatever clone left behind
+		_ = RemoveRepo(forkRepoName)
+
+		return err
+	}
+
+	// the fork is not meant to track the parent like a remote
+	if _, err := runGitCommand(forkAbsolutePath, "remote", "remove", "origin"); err != nil {
+		_ = RemoveRepo(forkRepoName)
+
+		return err
+	}
+
+	if err := initRepoMetadata(forkRepoName, parentRepoName); err != nil {
+		_ = RemoveRepo(forkRepoName)
+
+		return err
+	}
+
+	return nil
+}
+
+// GetRepoParent name of the repo from which this repo was forked, empty if it is not a fork
+func GetRepoParent(repoName string) string {
+	metadata, err := GetRepoMetadata(repoName)
+	if err != nil {
+		return ""
+	}
+
+	return metadata.Parent
+}
+
+// getLegacyRepoParent parent of a fork kept in git config, empty if there is none
+func getLegacyRepoParent(repoName string) string {
+	parentRepoName, err := runGitCommand(GetRepoAbsolutePath(repoName), "config", "--get", parentConfigKey)
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(parentRepoName))
+}
+
+// unsetLegacyRepoParent remove the parent kept in git config, git exits with 5 when it is not set
+func unsetLegacyRepoParent(repoAbsolutePath string) error {
+	_, err := runGitCommand(repoAbsolutePath, "config", "--unset", parentConfigKey)
+
+	var exitErr *exec.ExitError
+	if err != nil && !(errors.As(err, &exitErr) && exitErr.ExitCode() == 5) {
+		return err
+	}
+
+	return nil
+}
+
+// GetRepoForks names of all repos directly forked from this repo
+func GetRepoForks(repoName string) ([]string, error) {
+	repoNames, err := ListRepoNames()
+	if err != nil {
+		return nil, err
+	}
+
+	forks := []string{}
+
+	for _, name := range repoNames {
+		if GetRepoParent(name) == repoName {
+			forks = append(forks, name)
+		}
+	}
+
+	return forks, nil
+}
+
+// DetachRepoForks copy the objects borrowed from this repo into each of its forks,
+// so the forks stay intact once this repo is removed
+func DetachRepoForks(repoName string) error {
+	forks, err := GetRepoForks(repoName)
+	if err != nil {
+		return err
+	}
+
+	for _, fork := range forks {
+		forkAbsolutePath := GetRepoAbsolutePath(fork)
+
+		// without -l repack also packs the objects reachable only through alternates
+		if _, err := runGitCommand(forkAbsolutePath, "repack", "-a", "-d", "-q"); err != nil {
+			return err
+		}
+
+		if err := os.Remove(getAlternatesPath(forkAbsolutePath)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+
+		if err := unsetLegacyRepoParent(forkAbsolutePath); err != nil {
+			return err
+		}
+
+		if err := setRepoParent(fork, ""); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// updateForksParent point the forks of a renamed repo to the new location of its objects
+func updateForksParent(forks []string, newParentRepoName string) error {
+	objectsAbsolutePath, err := getObjectsAbsolutePath(newParentRepoName)
+	if err != nil {
+		return err
+	}
+
+	for _, fork := range forks {
+		forkAbsolutePath := GetRepoAbsolutePath(fork)
+
+		if err := ioutil.WriteFile(getAlternatesPath(forkAbsolutePath), []byte(objectsAbsolutePath+"\n"), 0600); err != nil {
+			return err
+		}
+
+		if err := unsetLegacyRepoParent(forkAbsolutePath); err != nil {
+			return err
+		}
+
+		if err := setRepoParent(fork, newParentRepoName); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
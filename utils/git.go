@@ -0,0 +1,182 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// ErrRefNotFound returned when a ref or revision cannot be resolved in the repo
+var ErrRefNotFound = errors.New("ref not found")
+
+// runGitCommand run git with given args inside the dir and return its stdout,
+// in case of failure the error contains what git wrote on stderr
+func runGitCommand(dir string, args ...string) ([]byte, error) {
+	return runGitCommandWithInput(dir, nil, nil, args...)
+}
+
+// runGitCommandWithInput run git like runGitCommand, with input passed on stdin
+// and extra environment variables added to the current environment
+func runGitCommandWithInput(dir string, input []byte, env []string, args ...string) ([]byte, error) {
+	var stderr bytes.Buffer
+
+	gitCommand := exec.Command("git", args...)
+	gitCommand.Dir = dir
+	gitCommand.Stderr = &stderr
+
+	if input != nil {
+		gitCommand.Stdin = bytes.NewReader(input)
+	}
+
+	if env != nil {
+		gitCommand.Env = append(os.Environ(), env...)
+	}
+
+	out, err := gitCommand.Output()
+
+	if err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return out, errors.New(message)
+		}
+
+		return out, err
+	}
+
+	return out, nil
+}
+
+// gitCommandReader stdout of a running git command, closing it waits for the command to exit
+type gitCommandReader struct {
+	io.ReadCloser
+	command *exec.Cmd
+	stderr  *bytes.Buffer
+}
+
+func (reader *gitCommandReader) Close() error {
+	// if the output was not read fully git fails on the closed pipe instead of blocking
+	_ = reader.ReadCloser.Close()
+
+	if err := reader.command.Wait(); err != nil {
+		if message := strings.TrimSpace(reader.stderr.String()); message != "" {
+			return errors.New(message)
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// startGitCommand start git with given args inside the dir and stream its stdout,
+// used for outputs which are too large to buffer in memory
+func startGitCommand(dir string, args ...string) (io.ReadCloser, error) {
+	var stderr bytes.Buffer
+
+	gitCommand := exec.Command("git", args...)
+	gitCommand.Dir = dir
+	gitCommand.Stderr = &stderr
+
+	stdout, err := gitCommand.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := gitCommand.Start(); err != nil {
+		return nil, err
+	}
+
+	return &gitCommandReader{stdout, gitCommand, &stderr}, nil
+}
+
+// resolveCommit resolve branch, tag or sha to the full sha of the commit it points to
+func resolveCommit(repoAbsolutePath string, rev string) (string, error) {
+	// a leading dash would be read as an option by git
+	if rev == "" || strings.HasPrefix(rev, "-") {
+		return "", ErrRefNotFound
+	}
+
+	sha, err := runGitCommand(repoAbsolutePath, "rev-parse", "--verify", "--quiet", "--end-of-options", rev+"^{commit}")
+
+	switch {
+	case err == nil:
+		return strings.TrimSpace(string(sha)), nil
+	case !isRevNotFound(sha, err):
+		return "", fmt.Errorf("cannot resolve %s: %w", rev, err)
+	}
+
+	// --quiet hides a ref pointing to a missing object as well, which means the repo is corrupt
+	fullRefName, err := resolveFullRefName(repoAbsolutePath, rev)
+
+	switch {
+	case errors.Is(err, ErrRefNotFound):
+		return "", ErrRefNotFound
+	case err != nil:
+		return "", err
+	}
+
+	if _, err := runGitCommand(repoAbsolutePath, "cat-file", "-e", fullRefName); err != nil {
+		return "", fmt.Errorf("corrupt repo, %s points to a missing object", fullRefName)
+	}
+
+	return "", ErrRefNotFound
+}
+
+// isRevNotFound check if git rev-parse --verify --quiet failed only because the rev does not
+// exist, it then exits with 1 without any output, other failures come with git's stderr
+func isRevNotFound(out []byte, err error) bool {
+	var exitErr *exec.ExitError
+
+	return errors.As(err, &exitErr) && exitErr.ExitCode() == 1 && len(bytes.TrimSpace(out)) == 0
+}
+
+// resolveFullRefName resolve a short branch or tag name to its full ref name
+func resolveFullRefName(repoAbsolutePath string, ref string) (string, error) {
+	if ref == "" || strings.HasPrefix(ref, "-") {
+		return "", ErrRefNotFound
+	}
+
+	fullRefName, err := runGitCommand(repoAbsolutePath, "rev-parse", "--verify", "--quiet", "--symbolic-full-name", "--end-of-options", ref)
+
+	switch {
+	case err != nil && !isRevNotFound(fullRefName, err):
+		return "", fmt.Errorf("cannot resolve %s: %w", ref, err)
+	case err != nil || strings.TrimSpace(string(fullRefName)) == "":
+		return "", ErrRefNotFound
+	}
+
+	return strings.TrimSpace(string(fullRefName)), nil
+}
+
+// isRepoEmpty check if the repo has no refs at all
+func isRepoEmpty(repoAbsolutePath string) (bool, error) {
+	refs, err := runGitCommand(repoAbsolutePath, "for-each-ref", "--count=1")
+	if err != nil {
+		return false, err
+	}
+
+	return len(bytes.TrimSpace(refs)) == 0, nil
+}
+
+// resolveHead commit HEAD points to, ErrEmptyRepo is returned when the repo has no commits yet
+func resolveHead(repoAbsolutePath string) (string, error) {
+	commitSha, err := resolveCommit(repoAbsolutePath, "HEAD")
+	if !errors.Is(err, ErrRefNotFound) {
+		return commitSha, err
+	}
+
+	// HEAD of an empty repo points to an unborn branch, anything else is a broken repo
+	isEmpty, emptyErr := isRepoEmpty(repoAbsolutePath)
+
+	switch {
+	case emptyErr != nil:
+		return "", emptyErr
+	case isEmpty:
+		return "", ErrEmptyRepo
+	default:
+		return "", fmt.Errorf("%w: HEAD", err)
+	}
+}
@@ -0,0 +1,232 @@
+package utils
+
+import (
+	"strings"
+)
+
+// GraphCommit commit with its parents, refs pointing to it and its place in the graph,
+// Lane is the column of the commit and ParentLanes the columns its parents continue on
+type GraphCommit struct {
+	CommitItem
+	Parents     []string `json:"parents"`
+	Refs        []string `json:"refs"`
+	Lane        int      `json:"lane"`
+	ParentLanes []int    `json:"parentLanes"`
+}
+
+// CommitsGraph a page of the commits graph, Heads are the commits the graph started
+// from so the next page can be asked from them even after new commits are pushed
+type CommitsGraph struct {
+	Heads      []string      `json:"heads"`
+	Commits    []GraphCommit `json:"commits"`
+	NextCursor string        `json:"nextCursor,omitempty"`
+}
+
+// graphLanes columns of the graph, each holding the sha of the commit expected next in it
+type graphLanes []string
+
+// place put the sha in its existing lane or the first free one and return the lane
+func (lanes *graphLanes) place(sha string) int {
+	free := -1
+
+	for i, laneSha := range *lanes {
+		if laneSha == sha {
+			return i
+		}
+
+		if laneSha == "" && free < 0 {
+			free = i
+		}
+	}
+
+	if free < 0 {
+		*lanes = append(*lanes, sha)
+		return len(*lanes) - 1
+	}
+
+	(*lanes)[free] = sha
+
+	return free
+}
+
+// next assign lanes to the commit and its parents, every other lane waiting for
+// the commit merges into its lane and is freed
+func (lanes *graphLanes) next(sha string, parents []string) (int, []int) {
+	lane := lanes.place(sha)
+
+	for i, laneSha := range *lanes {
+		if laneSha == sha && i != lane {
+			(*lanes)[i] = ""
+		}
+	}
+
+	(*lanes)[lane] = ""
+	parentLanes := make([]int, 0, len(parents))
+
+	for i, parent := range parents {
+		// the first parent carries on in the lane of the commit unless it already has one
+		if i == 0 && !lanes.contains(parent) {
+			(*lanes)[lane] = parent
+			parentLanes = append(parentLanes, lane)
+
+			continue
+		}
+
+		parentLanes = append(parentLanes, lanes.place(parent))
+	}
+
+	for len(*lanes) > 0 && (*lanes)[len(*lanes)-1] == "" {
+		*lanes = (*lanes)[:len(*lanes)-1]
+	}
+
+	return lane, parentLanes
+}
+
+func (lanes graphLanes) contains(sha string) bool {
+	for _, laneSha := range lanes {
+		if laneSha == sha {
+			return true
+		}
+	}
+
+	return false
+}
+
+// getRefDecorations full names of the refs pointing to each commit, tags are peeled
+func getRefDecorations(repoAbsolutePath string) (map[string][]string, error) {
+	out, err := runGitCommand(repoAbsolutePath, "for-each-ref", "--format=%(objectname) %(*objectname) %(refname)")
+	if err != nil {
+		return nil, err
+	}
+
+	decorations := make(map[string][]string)
+
+	for _, line := range strings.Split(strings.TrimSpace(string(out)), "\n") {
+		fields := strings.SplitN(line, " ", 3)
+		if len(fields) != 3 {
+			continue
+		}
+
+		sha := fields[0]
+		if fields[1] != "" {
+			sha = fields[1]
+		}
+
+		decorations[sha] = append(decorations[sha], fields[2])
+	}
+
+	return decorations, nil
+}
+
+// resolveGraphHeads commits of the refs, all branches when no ref is given
+func resolveGraphHeads(repoAbsolutePath string, refs []string) ([]string, error) {
+	if len(refs) == 0 {
+		out, err := runGitCommand(repoAbsolutePath, "for-each-ref", "--format=%(objectname)", "refs/heads/")
+		if err != nil {
+			return nil, err
+		}
+
+		refs = strings.Fields(string(out))
+	}
+
+	heads := []string{}
+	seen := make(map[string]bool)
+
+	for _, ref := range refs {
+		commitSha, err := resolveCommit(repoAbsolutePath, ref)
+		if err != nil {
+			return nil, err
+		}
+
+		if !seen[commitSha] {
+			seen[commitSha] = true
+			heads = append(heads, commitSha)
+		}
+	}
+
+	return heads, nil
+}
+
+// GetCommitsGraph a page of commits reachable from the refs in topological order, lanes are
+// assigned walking from the heads so they stay the same across pages
+func GetCommitsGraph(repoName string, refs []string, after string, perPage int64) (*CommitsGraph, error) {
+	repoAbsolutePath := GetRepoAbsolutePath(repoName)
+	graph := &CommitsGraph{Heads: []string{}, Commits: []GraphCommit{}}
+
+	if after != "" && !isFullSha(after) {
+		return nil, ErrInvalidCursor
+	}
+
+	heads, err := resolveGraphHeads(repoAbsolutePath, refs)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(heads) == 0 {
+		return graph, nil
+	}
+
+	graph.Heads = heads
+
+	args := append([]string{"rev-list", "--topo-order", "--parents"}, heads...)
+
+	revList, err := startGitCommand(repoAbsolutePath, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	lanes := graphLanes{}
+
+	// lanes are assigned to the commits before the cursor as well
+	hasMore, err := scanRevListPage(revList, after, perPage, func(shas []string, inPage bool) {
+		lane, parentLanes := lanes.next(shas[0], shas[1:])
+
+		if inPage {
+			graph.Commits = append(graph.Commits, GraphCommit{
+				CommitItem:  CommitItem{Commit: shas[0]},
+				Parents:     shas[1:],
+				Refs:        []string{},
+				Lane:        lane,
+				ParentLanes: parentLanes,
+			})
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if hasMore {
+		graph.NextCursor = graph.Commits[len(graph.Commits)-1].Commit
+	}
+
+	if len(graph.Commits) == 0 {
+		return graph, nil
+	}
+
+	shas := make([]string, 0, len(graph.Commits))
+
+	for _, commit := range graph.Commits {
+		shas = append(shas, commit.Commit)
+	}
+
+	commitsBySha, err := getCommitItems(repoAbsolutePath, shas)
+	if err != nil {
+		return nil, err
+	}
+
+	decorations, err := getRefDecorations(repoAbsolutePath)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range graph.Commits {
+		commit := &graph.Commits[i]
+		commit.CommitItem = commitsBySha[commit.Commit]
+
+		if commitRefs, ok := decorations[commit.Commit]; ok {
+			commit.Refs = commitRefs
+		}
+	}
+
+	return graph, nil
+}
@@ -0,0 +1,174 @@
+package utils
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ErrInvalidCursor returned when the log cursor is not a commit in the log
+var ErrInvalidCursor = errors.New("cursor is not a commit in this log")
+
+// LogOptions filters and page of a commits log, empty fields are not applied
+type LogOptions struct {
+	Ref         string
+	Path        string
+	Author      string
+	Committer   string
+	Since       string
+	Until       string
+	Grep        string
+	FirstParent bool
+	NoMerges    bool
+
+	// After commit sha from which the log continues, when set Page is ignored
+	After   string
+	Page    int64
+	PerPage int64
+}
+
+// CommitsLog a page of commits log, Head is the commit the log started from so the
+// next page can be asked from it even after new commits are pushed
+type CommitsLog struct {
+	Head       string       `json:"head"`
+	Commits    []CommitItem `json:"commits"`
+	NextCursor string       `json:"nextCursor,omitempty"`
+}
+
+// getLogArgs git log filter args and pathspec for the options, every value goes in
+// its own argument so it can never be read as another option
+func getLogArgs(options LogOptions) ([]string, []string, error) {
+	args := []string{}
+
+	filters := []struct {
+		flag  string
+		value string
+	}{
+		{"--author=", options.Author},
+		{"--committer=", options.Committer},
+		{"--since=", options.Since},
+		{"--until=", options.Until},
+		{"--grep=", options.Grep},
+	}
+
+	for _, filter := range filters {
+		if filter.value != "" {
+			args = append(args, filter.flag+filter.value)
+		}
+	}
+
+	if options.FirstParent {
+		args = append(args, "--first-parent")
+	}
+
+	if options.NoMerges {
+		args = append(args, "--no-merges")
+	}
+
+	pathspec := []string{"--"}
+
+	if options.Path != "" {
+		filePath, err := cleanTreePath(options.Path)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if filePath != "" {
+			pathspec = append(pathspec, filePath)
+		}
+	}
+
+	return args, pathspec, nil
+}
+
+// listLogShas shas of the commits in the page and whether more commits follow it,
+// with a cursor the log is read up to the cursor and the page starts right after it
+func listLogShas(repoAbsolutePath string, headSha string, options LogOptions) ([]string, bool, error) {
+	logArgs, pathspec, err := getLogArgs(options)
+	if err != nil {
+		return nil, false, err
+	}
+
+	args := append([]string{"--literal-pathspecs", "rev-list"}, logArgs...)
+
+	if options.After == "" {
+		// one more than the page tells if there is a next page
+		args = append(args, fmt.Sprintf("--max-count=%d", options.PerPage+1), fmt.Sprintf("--skip=%d", options.Page*options.PerPage))
+	}
+
+	args = append(append(args, headSha), pathspec...)
+
+	revList, err := startGitCommand(repoAbsolutePath, args...)
+	if err != nil {
+		return nil, false, err
+	}
+
+	shas := []string{}
+
+	hasMore, err := scanRevListPage(revList, options.After, options.PerPage, func(fields []string, inPage bool) {
+		if inPage {
+			shas = append(shas, fields[0])
+		}
+	})
+	if err != nil {
+		return nil, false, err
+	}
+
+	return shas, hasMore, nil
+}
+
+// scanRevListPage scan rev-list output for a page of perPage commits, with a cursor the page
+// starts right after the cursor commit. Every line up to the end of the page is passed to visit
+// split into fields, inPage tells if the line is part of the page. The returned bool tells if
+// more commits follow the page
+func scanRevListPage(revList io.ReadCloser, after string, perPage int64, visit func(fields []string, inPage bool)) (bool, error) {
+	cursorFound := after == ""
+	pageCount := int64(0)
+	hasMore := false
+
+	scanner := bufio.NewScanner(revList)
+
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		// one more than the page tells if there is a next page
+		if cursorFound && pageCount == perPage {
+			hasMore = true
+			break
+		}
+
+		visit(fields, cursorFound)
+
+		switch {
+		case cursorFound:
+			pageCount++
+		case fields[0] == after:
+			cursorFound = true
+		}
+	}
+
+	// rev-list fails on the closed pipe when its output is not read fully
+	if err := revList.Close(); err != nil && !hasMore {
+		return false, err
+	}
+
+	if err := scanner.Err(); err != nil && !hasMore {
+		return false, err
+	}
+
+	if !cursorFound {
+		return false, ErrInvalidCursor
+	}
+
+	return hasMore, nil
+}
+
+// isFullSha full hex sha of a git object, commits as well as tags
+func isFullSha(sha string) bool {
+	return len(sha) == 40 && strings.Trim(sha, "0123456789abcdef") == ""
+}
@@ -0,0 +1,216 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"sync"
+	"time"
+)
+
+const (
+	RepoVisibility_Public  string = "public"
+	RepoVisibility_Private string = "private"
+)
+
+// metadataFileName file inside the bare repo dir where its metadata is kept,
+// so the metadata moves along when the repo is renamed or trashed
+const metadataFileName string = "gitbox.json"
+
+const (
+	maxDescriptionLength = 350
+	maxTopicsCount       = 20
+)
+
+// RepoMetadata information about a repo which is not part of its git data
+type RepoMetadata struct {
+	Description string    `json:"description"`
+	Visibility  string    `json:"visibility"`
+	Topics      []string  `json:"topics"`
+	Owner       string    `json:"owner"`
+	CreatedAt   time.Time `json:"createdAt"`
+	Parent      string    `json:"parent,omitempty"`
+}
+
+// RepoMetadataUpdate fields of metadata to change, nil fields are left as they are
+type RepoMetadataUpdate struct {
+	Description *string  `json:"description"`
+	Visibility  *string  `json:"visibility"`
+	Topics      []string `json:"topics"`
+	Owner       *string  `json:"owner"`
+}
+
+// ErrInvalidMetadata returned when a metadata update has invalid values
+var ErrInvalidMetadata = errors.New("invalid metadata")
+
+var topicCheckRegEx = regexp.MustCompile(`^[a-z0-9][a-z0-9\-]{0,49}$`).MatchString
+
+// metadataLock serializes metadata writes, as updates read the file before writing it
+var metadataLock sync.Mutex
+
+func getMetadataPath(repoName string) string {
+	return path.Join(GetRepoAbsolutePath(repoName), metadataFileName)
+}
+
+// GetRepoMetadata read metadata of the repo, repos created before metadata
+// existed get the defaults
+func GetRepoMetadata(repoName string) (*RepoMetadata, error) {
+	metadata := &RepoMetadata{
+		Visibility: RepoVisibility_Public,
+		Topics:     []string{},
+	}
+
+	metadataJSON, err := ioutil.ReadFile(getMetadataPath(repoName))
+
+	switch {
+	case os.IsNotExist(err):
+		metadata.CreatedAt = getRepoCreatedAt(GetRepoAbsolutePath(repoName))
+	case err != nil:
+		return nil, err
+	default:
+		if err := json.Unmarshal(metadataJSON, metadata); err != nil {
+			return nil, err
+		}
+	}
+
+	// owner of a namespaced repo is always its namespace
+	if namespace := getRepoNamespace(repoName); namespace != "" {
+		metadata.Owner = namespace
+	}
+
+	// forks made before the parent was kept in metadata only have it in git config,
+	// only a repo borrowing objects through alternates can be such a fork
+	if metadata.Parent == "" {
+		if _, err := os.Stat(getAlternatesPath(GetRepoAbsolutePath(repoName))); err == nil {
+			metadata.Parent = getLegacyRepoParent(repoName)
+		}
+	}
+
+	return metadata, nil
+}
+
+func writeRepoMetadata(repoName string, metadata *RepoMetadata) error {
+	metadataJSON, err := json.MarshalIndent(metadata, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	// write to a temp file first so a failed write never leaves a half written file
+	tempPath := getMetadataPath(repoName) + ".tmp"
+
+	if err := ioutil.WriteFile(tempPath, metadataJSON, 0600); err != nil {
+		return err
+	}
+
+	return os.Rename(tempPath, getMetadataPath(repoName))
+}
+
+// initRepoMetadata record the creation time of a newly created repo, and the repo
+// it was forked from if it is a fork
+func initRepoMetadata(repoName string, parentRepoName string) error {
+	metadataLock.Lock()
+	defer metadataLock.Unlock()
+
+	return writeRepoMetadata(repoName, &RepoMetadata{
+		Visibility: RepoVisibility_Public,
+		Topics:     []string{},
+		Owner:      getRepoNamespace(repoName),
+		CreatedAt:  time.Now().UTC(),
+		Parent:     parentRepoName,
+	})
+}
+
+// setRepoParent record the repo from which this repo was forked, empty once it is detached
+func setRepoParent(repoName string, parentRepoName string) error {
+	metadataLock.Lock()
+	defer metadataLock.Unlock()
+
+	metadata, err := GetRepoMetadata(repoName)
+	if err != nil {
+		return err
+	}
+
+	metadata.Parent = parentRepoName
+
+	return writeRepoMetadata(repoName, metadata)
+}
+
+// Validate check the values of the update, topics are deduplicated
+func (update *RepoMetadataUpdate) Validate(repoName string) error {
+	if update.Description != nil && len(*update.Description) > maxDescriptionLength {
+		return fmt.Errorf("%w: description can be at most %d characters", ErrInvalidMetadata, maxDescriptionLength)
+	}
+
+	if update.Visibility != nil && *update.Visibility != RepoVisibility_Public && *update.Visibility != RepoVisibility_Private {
+		return fmt.Errorf("%w: visibility can only be public or private", ErrInvalidMetadata)
+	}
+
+	if update.Owner != nil && getRepoNamespace(repoName) != "" {
+		return fmt.Errorf("%w: owner of a namespaced repo is its namespace", ErrInvalidMetadata)
+	}
+
+	if update.Topics != nil {
+		if len(update.Topics) > maxTopicsCount {
+			return fmt.Errorf("%w: at most %d topics are allowed", ErrInvalidMetadata, maxTopicsCount)
+		}
+
+		topics := []string{}
+		seenTopics := make(map[string]bool)
+
+		for _, topic := range update.Topics {
+			if !topicCheckRegEx(topic) {
+				return fmt.Errorf("%w: topic %q can only contain lowercase alpha numeric characters and '-'", ErrInvalidMetadata, topic)
+			}
+
+			if !seenTopics[topic] {
+				seenTopics[topic] = true
+				topics = append(topics, topic)
+			}
+		}
+
+		update.Topics = topics
+	}
+
+	return nil
+}
+
+// UpdateRepoMetadata apply the update to metadata of the repo
+func UpdateRepoMetadata(repoName string, update *RepoMetadataUpdate) (*RepoMetadata, error) {
+	if err := update.Validate(repoName); err != nil {
+		return nil, err
+	}
+
+	metadataLock.Lock()
+	defer metadataLock.Unlock()
+
+	metadata, err := GetRepoMetadata(repoName)
+	if err != nil {
+		return nil, err
+	}
+
+	if update.Description != nil {
+		metadata.Description = *update.Description
+	}
+
+	if update.Visibility != nil {
+		metadata.Visibility = *update.Visibility
+	}
+
+	if update.Topics != nil {
+		metadata.Topics = update.Topics
+	}
+
+	if update.Owner != nil {
+		metadata.Owner = *update.Owner
+	}
+
+	if err := writeRepoMetadata(repoName, metadata); err != nil {
+		return nil, err
+	}
+
+	return metadata, nil
+}
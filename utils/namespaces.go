@@ -0,0 +1,89 @@
+package utils
+
+import (
+	"errors"
+	"os"
+	"path"
+	"strings"
+)
+
+// Repos are either flat, living directly in REPO_BASE_DIR which acts as the default namespace,
+// or namespaced as owner/repo, living in a directory per owner inside REPO_BASE_DIR.
+
+// ErrNamespaceTaken returned when the owner of a namespaced repo is already a flat repo
+var ErrNamespaceTaken = errors.New("namespace is already taken by a repo")
+
+// getRepoNamespace owner of the repo, empty for repos in the default namespace
+func getRepoNamespace(repoName string) string {
+	if namespacePieces := strings.SplitN(repoName, "/", 2); len(namespacePieces) == 2 {
+		return namespacePieces[0]
+	}
+
+	return ""
+}
+
+// IsNamespace check if the name is an owner directory holding namespaced repos
+func IsNamespace(name string) bool {
+	if name == "" || strings.HasPrefix(name, ".") {
+		return false
+	}
+
+	info, err := os.Stat(GetRepoAbsolutePath(name))
+	if err != nil || !info.IsDir() {
+		return false
+	}
+
+	return !IsBareRepo(GetRepoAbsolutePath(name))
+}
+
+// ResolveRepoName split a url path into the repo name and the action following it,
+// name is the first path segment and action the rest of the path.
+// A flat repo always wins over a namespace. With allowNewNamespace an owner which does
+// not exist yet is assumed when an action follows the repo name, e.g. /owner/repo/import
+func ResolveRepoName(name string, action string, allowNewNamespace bool) (string, string) {
+	actionPieces := strings.SplitN(strings.TrimPrefix(action, "/"), "/", 2)
+	repoSegment := actionPieces[0]
+
+	if repoSegment == "" {
+		return name, "/"
+	}
+
+	if IsBareRepo(GetRepoAbsolutePath(name)) {
+		return name, action
+	}
+
+	_, err := os.Stat(GetRepoAbsolutePath(name))
+	isUnknownOwner := allowNewNamespace && os.IsNotExist(err) && len(actionPieces) == 2 && actionPieces[1] != ""
+
+	if !IsNamespace(name) && !isUnknownOwner {
+		return name, action
+	}
+
+	remainingAction := "/"
+	if len(actionPieces) == 2 {
+		remainingAction += actionPieces[1]
+	}
+
+	return name + "/" + repoSegment, remainingAction
+}
+
+// ResolveWebSocketRepoName repo name of a websocket subscription path, clients can subscribe
+// before the repo or its owner exists so a second path segment always names a repo of the
+// owner, unless the first segment is a flat repo
+func ResolveWebSocketRepoName(name string, action string) string {
+	repoSegment := strings.Trim(action, "/")
+
+	if repoSegment == "" || IsBareRepo(GetRepoAbsolutePath(name)) {
+		return name
+	}
+
+	return name + "/" + repoSegment
+}
+
+// cleanupNamespaceDir remove the owner directory once its last repo is gone
+func cleanupNamespaceDir(repoName string) {
+	if namespace := getRepoNamespace(repoName); namespace != "" {
+		// fails when the directory still has repos, which is expected
+		_ = os.Remove(path.Dir(GetRepoAbsolutePath(repoName)))
+	}
+}
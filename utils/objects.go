@@ -0,0 +1,153 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"gitbox/config"
+	"strings"
+)
+
+// TreeEntry a single entry of a git tree object
+type TreeEntry struct {
+	Mode string `json:"mode"`
+	Type string `json:"type"`
+	Sha  string `json:"sha"`
+	Name string `json:"name"`
+	Path string `json:"path,omitempty"`
+	Size *int64 `json:"size,omitempty"`
+}
+
+// ErrInvalidBranchName returned when a name cannot be used as git branch name
+var ErrInvalidBranchName = errors.New("invalid branch name")
+
+// IsBranchNameValid check if the name is allowed as a git branch name
+func IsBranchNameValid(branchName string) bool {
+	if branchName == "" || strings.HasPrefix(branchName, "-") {
+		return false
+	}
+
+	_, err := runGitCommand("", "check-ref-format", "refs/heads/"+branchName)
+
+	return err == nil
+}
+
+// ErrInvalidTagName returned when a name cannot be used as git tag name
+var ErrInvalidTagName = errors.New("invalid tag name")
+
+// IsTagNameValid check if the name is allowed as a git tag name
+func IsTagNameValid(tagName string) bool {
+	if tagName == "" || strings.HasPrefix(tagName, "-") {
+		return false
+	}
+
+	_, err := runGitCommand("", "check-ref-format", "refs/tags/"+tagName)
+
+	return err == nil
+}
+
+// getCommitEnv environment variables setting author and committer of a commit,
+// the server identity is used when no author is given
+func getCommitEnv(author *Author) []string {
+	name, email := config.CommitAuthorName, config.CommitAuthorEmail
+
+	if author != nil && author.Name != "" && author.Email != "" {
+		name, email = author.Name, author.Email
+	}
+
+	env := []string{
+		"GIT_AUTHOR_NAME=" + name,
+		"GIT_AUTHOR_EMAIL=" + email,
+		"GIT_COMMITTER_NAME=" + name,
+		"GIT_COMMITTER_EMAIL=" + email,
+	}
+
+	if author != nil && author.Date != "" {
+		env = append(env, "GIT_AUTHOR_DATE="+author.Date)
+	}
+
+	return env
+}
+
+// writeBlob store the content as a blob object in the repo and return its sha
+func writeBlob(repoAbsolutePath string, content []byte) (string, error) {
+	sha, err := runGitCommandWithInput(repoAbsolutePath, content, nil, "hash-object", "-w", "--stdin")
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(sha)), nil
+}
+
+// readTree list the entries directly inside a tree
+func readTree(repoAbsolutePath string, treeish string) ([]TreeEntry, error) {
+	out, err := runGitCommand(repoAbsolutePath, "ls-tree", "-z", "--end-of-options", treeish)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []TreeEntry{}
+
+	for _, line := range strings.Split(string(out), "\x00") {
+		// each line is "<mode> <type> <sha>\t<name>"
+		linePieces := strings.SplitN(line, "\t", 2)
+		if len(linePieces) != 2 {
+			continue
+		}
+
+		fields := strings.Fields(linePieces[0])
+		if len(fields) != 3 {
+			continue
+		}
+
+		entries = append(entries, TreeEntry{Mode: fields[0], Type: fields[1], Sha: fields[2], Name: linePieces[1]})
+	}
+
+	return entries, nil
+}
+
+// writeTree store a tree object with the given entries and return its sha
+func writeTree(repoAbsolutePath string, entries []TreeEntry) (string, error) {
+	var input strings.Builder
+
+	for _, entry := range entries {
+		fmt.Fprintf(&input, "%s %s %s\t%s\x00", entry.Mode, entry.Type, entry.Sha, entry.Name)
+	}
+
+	sha, err := runGitCommandWithInput(repoAbsolutePath, []byte(input.String()), nil, "mktree", "-z")
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(sha)), nil
+}
+
+// commitTree create a commit object for the tree and return its sha
+func commitTree(repoAbsolutePath string, treeSha string, parents []string, message string, author *Author) (string, error) {
+	args := []string{"commit-tree", treeSha}
+
+	for _, parent := range parents {
+		args = append(args, "-p", parent)
+	}
+
+	sha, err := runGitCommandWithInput(repoAbsolutePath, []byte(message), getCommitEnv(author), args...)
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(sha)), nil
+}
+
+// updateRef point the ref to the new sha only if it still points to oldSha,
+// an empty oldSha means the ref must not exist yet
+func updateRef(repoAbsolutePath string, ref string, newSha string, oldSha string) error {
+	_, err := runGitCommand(repoAbsolutePath, "update-ref", ref, newSha, oldSha)
+
+	return err
+}
+
+// deleteRef delete the ref only if it still points to oldSha
+func deleteRef(repoAbsolutePath string, ref string, oldSha string) error {
+	_, err := runGitCommand(repoAbsolutePath, "update-ref", "-d", ref, oldSha)
+
+	return err
+}
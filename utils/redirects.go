@@ -0,0 +1,60 @@
+package utils
+
+import (
+	"sync"
+	"time"
+)
+
+type repoRedirect struct {
+	newRepoName string
+	expiresAt   time.Time
+}
+
+var (
+	repoRedirects     = make(map[string]repoRedirect)
+	repoRedirectsLock sync.Mutex
+)
+
+// AddRepoRedirect redirect the old name of a renamed repo to its new name for the given time
+func AddRepoRedirect(oldRepoName string, newRepoName string, ttl time.Duration) {
+	repoRedirectsLock.Lock()
+	defer repoRedirectsLock.Unlock()
+
+	expiresAt := time.Now().Add(ttl)
+
+	// older names pointing to the renamed repo now need to point to its new name
+	for repoName, redirect := range repoRedirects {
+		if redirect.newRepoName == oldRepoName {
+			repoRedirects[repoName] = repoRedirect{newRepoName, redirect.expiresAt}
+		}
+	}
+
+	delete(repoRedirects, newRepoName)
+	repoRedirects[oldRepoName] = repoRedirect{newRepoName, expiresAt}
+}
+
+// RemoveRepoRedirect stop redirecting the name, used when the name is taken by a repo again
+func RemoveRepoRedirect(repoName string) {
+	repoRedirectsLock.Lock()
+	defer repoRedirectsLock.Unlock()
+
+	delete(repoRedirects, repoName)
+}
+
+// GetRepoRedirect get the new name of a renamed repo if its redirect has not expired yet
+func GetRepoRedirect(repoName string) (string, bool) {
+	repoRedirectsLock.Lock()
+	defer repoRedirectsLock.Unlock()
+
+	redirect, ok := repoRedirects[repoName]
+	if !ok {
+		return "", false
+	}
+
+	if time.Now().After(redirect.expiresAt) {
+		delete(repoRedirects, repoName)
+		return "", false
+	}
+
+	return redirect.newRepoName, true
+}
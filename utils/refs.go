@@ -0,0 +1,394 @@
+package utils
+
+import (
+	"errors"
+	"fmt"
+	"gitbox/config"
+	"gitbox/models"
+	"strings"
+	"time"
+)
+
+// BranchItem branch with the commit it points to
+type BranchItem struct {
+	Name    string     `json:"name"`
+	Default bool       `json:"default"`
+	Commit  CommitItem `json:"commit"`
+}
+
+// TagItem tag with the commit it points to, tagger and message are only set for annotated tags
+type TagItem struct {
+	Name       string      `json:"name"`
+	Sha        string      `json:"sha"`
+	Annotated  bool        `json:"annotated"`
+	Target     string      `json:"target"`
+	TargetType string      `json:"targetType"`
+	Tagger     *Author     `json:"tagger,omitempty"`
+	Message    string      `json:"message,omitempty"`
+	Commit     *CommitItem `json:"commit,omitempty"`
+}
+
+// refRecordFormat NUL separated ref fields, every record ends with NUL and newline
+// as tag messages can span multiple lines but cannot contain NUL
+const refRecordFormat string = "--format=%(refname:lstrip=2)%00%(objectname)%00%(objecttype)%00" +
+	"%(*objectname)%00%(*objecttype)%00%(taggername)%00%(taggeremail)%00%(taggerdate:iso-strict)%00%(contents)%00"
+
+const refRecordFieldsCount = 9
+
+type refRecord struct {
+	name       string
+	sha        string
+	objectType string
+	target     string
+	targetType string
+	tagger     Author
+	message    string
+}
+
+// listRefRecords all refs under the prefix sorted by name
+func listRefRecords(repoAbsolutePath string, prefix string) ([]refRecord, error) {
+	out, err := runGitCommand(repoAbsolutePath, "for-each-ref", refRecordFormat, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	records := []refRecord{}
+
+	for _, line := range strings.Split(string(out), "\x00\n") {
+		if line == "" {
+			continue
+		}
+
+		fields := strings.SplitN(line, "\x00", refRecordFieldsCount)
+		if len(fields) != refRecordFieldsCount {
+			return nil, errors.New("cannot parse refs")
+		}
+
+		records = append(records, refRecord{
+			name:       fields[0],
+			sha:        fields[1],
+			objectType: fields[2],
+			target:     fields[3],
+			targetType: fields[4],
+			tagger: Author{
+				Name:  fields[5],
+				Email: strings.TrimSuffix(strings.TrimPrefix(fields[6], "<"), ">"),
+				Date:  fields[7],
+			},
+			message: strings.TrimRight(fields[8], "\n"),
+		})
+	}
+
+	return records, nil
+}
+
+// pageRefRecords records in the page, pageNum starts from 0
+func pageRefRecords(records []refRecord, pageNum int64, perPage int64) []refRecord {
+	start, end := PageBounds(len(records), pageNum, perPage)
+
+	return records[start:end]
+}
+
+// getCommitItems commits of the given shas keyed by sha, in a single git call
+func getCommitItems(repoAbsolutePath string, shas []string) (map[string]CommitItem, error) {
+	commitsBySha := make(map[string]CommitItem, len(shas))
+
+	if len(shas) == 0 {
+		return commitsBySha, nil
+	}
+
+	args := append([]string{"log", "--no-walk=unsorted", "-z", "--date=iso-strict", commitDetailFormat}, shas...)
+
+	out, err := runGitCommand(repoAbsolutePath, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	commits, err := parseCommitItems(string(out))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, commit := range commits {
+		commitsBySha[commit.Commit] = commit
+	}
+
+	return commitsBySha, nil
+}
+
+// ListBranches branches of the repo sorted by name with the total count
+func ListBranches(repoName string, pageNum int64, perPage int64) ([]BranchItem, int, error) {
+	repoAbsolutePath := GetRepoAbsolutePath(repoName)
+
+	records, err := listRefRecords(repoAbsolutePath, "refs/heads/")
+	if err != nil {
+		return nil, 0, err
+	}
+
+	pageRecords := pageRefRecords(records, pageNum, perPage)
+	shas := make([]string, 0, len(pageRecords))
+
+	for _, record := range pageRecords {
+		shas = append(shas, record.sha)
+	}
+
+	commitsBySha, err := getCommitItems(repoAbsolutePath, shas)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// an empty repo has HEAD pointing to an unborn branch
+	defaultBranch, _ := GetDefaultBranch(repoName)
+	branches := make([]BranchItem, 0, len(pageRecords))
+
+	for _, record := range pageRecords {
+		branches = append(branches, BranchItem{
+			Name:    record.name,
+			Default: record.name == defaultBranch,
+			Commit:  commitsBySha[record.sha],
+		})
+	}
+
+	return branches, len(records), nil
+}
+
+// ListTags tags of the repo sorted by name with the total count, annotated tags
+// are peeled to the object they finally point to
+func ListTags(repoName string, pageNum int64, perPage int64) ([]TagItem, int, error) {
+	repoAbsolutePath := GetRepoAbsolutePath(repoName)
+
+	records, err := listRefRecords(repoAbsolutePath, "refs/tags/")
+	if err != nil {
+		return nil, 0, err
+	}
+
+	pageRecords := pageRefRecords(records, pageNum, perPage)
+	tags := make([]TagItem, 0, len(pageRecords))
+
+	for _, record := range pageRecords {
+		tag := TagItem{
+			Name:       record.name,
+			Sha:        record.sha,
+			Target:     record.sha,
+			TargetType: record.objectType,
+		}
+
+		if record.objectType == "tag" {
+			tagger := record.tagger
+
+			tag.Annotated = true
+			tag.Tagger = &tagger
+			tag.Message = record.message
+			tag.Target = record.target
+			tag.TargetType = record.targetType
+
+			// a tag of a tag, peel it all the way down
+			if tag.TargetType == "tag" {
+				peeled, err := runGitCommand(repoAbsolutePath, "rev-parse", "--verify", "--quiet", record.sha+"^{}")
+				if err != nil {
+					return nil, 0, fmt.Errorf("cannot peel tag %s: %w", record.name, err)
+				}
+
+				tag.Target = strings.TrimSpace(string(peeled))
+
+				targetType, err := runGitCommand(repoAbsolutePath, "cat-file", "-t", tag.Target)
+				if err != nil {
+					return nil, 0, err
+				}
+
+				tag.TargetType = strings.TrimSpace(string(targetType))
+			}
+		}
+
+		tags = append(tags, tag)
+	}
+
+	shas := []string{}
+
+	for _, tag := range tags {
+		if tag.TargetType == "commit" {
+			shas = append(shas, tag.Target)
+		}
+	}
+
+	commitsBySha, err := getCommitItems(repoAbsolutePath, shas)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	for i := range tags {
+		if commit, ok := commitsBySha[tags[i].Target]; ok {
+			tags[i].Commit = &commit
+		}
+	}
+
+	return tags, len(records), nil
+}
+
+// ErrRefExists returned when a branch or tag to be created already exists
+var ErrRefExists = errors.New("ref already exists")
+
+// ErrInvalidOldSha returned when the expected old sha of a ref is not a full sha
+var ErrInvalidOldSha = errors.New("oldSha should be a full sha")
+
+// ErrDeleteDefaultBranch returned when deleting the branch HEAD points to
+var ErrDeleteDefaultBranch = errors.New("default branch cannot be deleted")
+
+// NewRef a branch or tag to be created at the commit of target, tags with a message are annotated.
+// Creating is a compare-and-swap against the null sha, so OldSha has to be the null sha of all zeros
+type NewRef struct {
+	Name    string  `json:"name" binding:"required"`
+	Target  string  `json:"target" binding:"required"`
+	OldSha  string  `json:"oldSha" binding:"required"`
+	Message string  `json:"message"`
+	Tagger  *Author `json:"tagger"`
+}
+
+// validate check the expected old sha, a ref to be created can only be expected to not exist
+func (newRef *NewRef) validate() error {
+	if newRef.OldSha != nullSha {
+		return fmt.Errorf("%w: a new ref can only be expected at the null sha", ErrInvalidOldSha)
+	}
+
+	return nil
+}
+
+// getRefSha object the ref points to, empty when the ref does not exist
+func getRefSha(repoAbsolutePath string, ref string) string {
+	sha, err := runGitCommand(repoAbsolutePath, "rev-parse", "--verify", "--quiet", ref)
+	if err != nil {
+		return ""
+	}
+
+	return strings.TrimSpace(string(sha))
+}
+
+// createRef point the new ref to the sha only if the ref does not exist yet
+func createRef(repoAbsolutePath string, ref string, sha string) (*models.MetadataInfo, error) {
+	if getRefSha(repoAbsolutePath, ref) != "" {
+		return nil, ErrRefExists
+	}
+
+	if err := updateRef(repoAbsolutePath, ref, sha, ""); err != nil {
+		// created by someone else in between
+		if getRefSha(repoAbsolutePath, ref) != "" {
+			return nil, ErrRefExists
+		}
+
+		return nil, err
+	}
+
+	return NewRefUpdateEvent(ref, "", sha), nil
+}
+
+// removeRef delete the ref only if it still points to oldSha
+func removeRef(repoAbsolutePath string, ref string, oldSha string) (*models.MetadataInfo, error) {
+	if !isFullSha(oldSha) {
+		return nil, ErrInvalidOldSha
+	}
+
+	currentSha := getRefSha(repoAbsolutePath, ref)
+
+	switch {
+	case currentSha == "":
+		return nil, ErrRefNotFound
+	case currentSha != oldSha:
+		return nil, ErrRefChanged
+	}
+
+	if err := deleteRef(repoAbsolutePath, ref, oldSha); err != nil {
+		if getRefSha(repoAbsolutePath, ref) != oldSha {
+			return nil, ErrRefChanged
+		}
+
+		return nil, err
+	}
+
+	return NewRefUpdateEvent(ref, oldSha, ""), nil
+}
+
+// CreateBranch create a branch at the commit of the target sha or ref, the returned event
+// is the same a push of the branch would send
+func CreateBranch(repoName string, newRef *NewRef) (*models.MetadataInfo, error) {
+	repoAbsolutePath := GetRepoAbsolutePath(repoName)
+
+	if !IsBranchNameValid(newRef.Name) {
+		return nil, ErrInvalidBranchName
+	}
+
+	if err := newRef.validate(); err != nil {
+		return nil, err
+	}
+
+	commitSha, err := resolveCommit(repoAbsolutePath, newRef.Target)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", err, newRef.Target)
+	}
+
+	return createRef(repoAbsolutePath, "refs/heads/"+newRef.Name, commitSha)
+}
+
+// CreateTag create a tag at the commit of the target sha or ref, annotated when a message is given
+func CreateTag(repoName string, newRef *NewRef) (*models.MetadataInfo, error) {
+	repoAbsolutePath := GetRepoAbsolutePath(repoName)
+
+	if !IsTagNameValid(newRef.Name) {
+		return nil, ErrInvalidTagName
+	}
+
+	if err := newRef.validate(); err != nil {
+		return nil, err
+	}
+
+	commitSha, err := resolveCommit(repoAbsolutePath, newRef.Target)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", err, newRef.Target)
+	}
+
+	tagRef := "refs/tags/" + newRef.Name
+
+	if newRef.Message == "" {
+		return createRef(repoAbsolutePath, tagRef, commitSha)
+	}
+
+	name, email := config.CommitAuthorName, config.CommitAuthorEmail
+
+	if newRef.Tagger != nil && newRef.Tagger.Name != "" && newRef.Tagger.Email != "" {
+		name, email = newRef.Tagger.Name, newRef.Tagger.Email
+	}
+
+	// like git does for identities, characters which would break the tagger line are dropped
+	identityCleaner := strings.NewReplacer("<", "", ">", "", "\n", "")
+
+	tagObject := fmt.Sprintf("object %s\ntype commit\ntag %s\ntagger %s <%s> %d +0000\n\n%s\n",
+		commitSha, newRef.Name, identityCleaner.Replace(name), identityCleaner.Replace(email), time.Now().Unix(), strings.TrimRight(newRef.Message, "\n"))
+
+	tagSha, err := runGitCommandWithInput(repoAbsolutePath, []byte(tagObject), nil, "mktag")
+	if err != nil {
+		return nil, err
+	}
+
+	return createRef(repoAbsolutePath, tagRef, strings.TrimSpace(string(tagSha)))
+}
+
+// DeleteBranch delete the branch only if it still points to oldSha, the default branch cannot be deleted
+func DeleteBranch(repoName string, branchName string, oldSha string) (*models.MetadataInfo, error) {
+	if !IsBranchNameValid(branchName) {
+		return nil, ErrInvalidBranchName
+	}
+
+	if defaultBranch, err := GetDefaultBranch(repoName); err == nil && defaultBranch == branchName {
+		return nil, ErrDeleteDefaultBranch
+	}
+
+	return removeRef(GetRepoAbsolutePath(repoName), "refs/heads/"+branchName, oldSha)
+}
+
+// DeleteTag delete the tag only if it still points to oldSha, for annotated tags it is the tag object sha
+func DeleteTag(repoName string, tagName string, oldSha string) (*models.MetadataInfo, error) {
+	if !IsTagNameValid(tagName) {
+		return nil, ErrInvalidTagName
+	}
+
+	return removeRef(GetRepoAbsolutePath(repoName), "refs/tags/"+tagName, oldSha)
+}
@@ -0,0 +1,350 @@
+package utils
+
+import (
+	"errors"
+	"gitbox/config"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	RepoSortBy_Name     string = "name"
+	RepoSortBy_Created  string = "created"
+	RepoSortBy_LastPush string = "pushed"
+)
+
+// LastCommitInfo sha and date of the latest commit on default branch
+type LastCommitInfo struct {
+	Commit string `json:"commit"`
+	Date   string `json:"date"`
+}
+
+// RepoSummary summary of a single repo shown in repo listing
+type RepoSummary struct {
+	Name          string          `json:"name"`
+	Size          int64           `json:"size"`
+	DefaultBranch string          `json:"defaultBranch"`
+	LastCommit    *LastCommitInfo `json:"lastCommit"`
+	RefsCount     int             `json:"refsCount"`
+	CreatedAt     time.Time       `json:"createdAt"`
+	LastPushAt    *time.Time      `json:"lastPushAt"`
+	Parent        string          `json:"parent,omitempty"`
+	Forks         []string        `json:"forks"`
+	Metadata      *RepoMetadata   `json:"metadata"`
+	Error         string          `json:"error,omitempty"`
+}
+
+// IsBareRepo check if the directory looks like a bare git repo
+func IsBareRepo(repoAbsolutePath string) bool {
+	if info, err := os.Stat(path.Join(repoAbsolutePath, "HEAD")); err != nil || info.IsDir() {
+		return false
+	}
+
+	if info, err := os.Stat(path.Join(repoAbsolutePath, "objects")); err != nil || !info.IsDir() {
+		return false
+	}
+
+	return true
+}
+
+// ListRepoNames names of all the repos present in repo base dir, including namespaced repos
+func ListRepoNames() ([]string, error) {
+	entries, err := ioutil.ReadDir(config.REPO_BASE_DIR)
+	if os.IsNotExist(err) {
+		return []string{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	repoNames := []string{}
+
+	for _, entry := range entries {
+		// hidden directories like trash are never repos
+		if !entry.IsDir() || strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+
+		if IsBareRepo(GetRepoAbsolutePath(entry.Name())) {
+			repoNames = append(repoNames, entry.Name())
+			continue
+		}
+
+		namespaceEntries, err := ioutil.ReadDir(GetRepoAbsolutePath(entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		for _, namespaceEntry := range namespaceEntries {
+			repoName := entry.Name() + "/" + namespaceEntry.Name()
+
+			if namespaceEntry.IsDir() && IsBareRepo(GetRepoAbsolutePath(repoName)) {
+				repoNames = append(repoNames, repoName)
+			}
+		}
+	}
+
+	return repoNames, nil
+}
+
+// getRepoCreatedAt git never modifies the description file after init, so its modification
+// time is used as creation time of repos which have no metadata yet
+func getRepoCreatedAt(repoAbsolutePath string) time.Time {
+	if info, err := os.Stat(path.Join(repoAbsolutePath, "description")); err == nil {
+		return info.ModTime().UTC()
+	}
+
+	if info, err := os.Stat(repoAbsolutePath); err == nil {
+		return info.ModTime().UTC()
+	}
+
+	return time.Time{}
+}
+
+// getRepoLastPushAt every push updates a ref, so latest modified ref file is the last push time
+func getRepoLastPushAt(repoAbsolutePath string) *time.Time {
+	var lastPushAt time.Time
+
+	_ = filepath.Walk(path.Join(repoAbsolutePath, "refs"), func(_ string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() && info.ModTime().After(lastPushAt) {
+			lastPushAt = info.ModTime()
+		}
+
+		return nil
+	})
+
+	if info, err := os.Stat(path.Join(repoAbsolutePath, "packed-refs")); err == nil && info.ModTime().After(lastPushAt) {
+		lastPushAt = info.ModTime()
+	}
+
+	if lastPushAt.IsZero() {
+		return nil
+	}
+
+	lastPushAt = lastPushAt.UTC()
+
+	return &lastPushAt
+}
+
+func getDirSize(dirPath string) int64 {
+	var size int64
+
+	_ = filepath.Walk(dirPath, func(_ string, info os.FileInfo, err error) error {
+		if err == nil && !info.IsDir() {
+			size += info.Size()
+		}
+
+		return nil
+	})
+
+	return size
+}
+
+// GetRepoSummary collect the summary info of a single repo
+func GetRepoSummary(repoName string) (*RepoSummary, error) {
+	repoAbsolutePath := GetRepoAbsolutePath(repoName)
+
+	metadata, err := GetRepoMetadata(repoName)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &RepoSummary{
+		Name:       repoName,
+		Size:       getDirSize(repoAbsolutePath),
+		CreatedAt:  metadata.CreatedAt,
+		LastPushAt: getRepoLastPushAt(repoAbsolutePath),
+		Parent:     metadata.Parent,
+		Forks:      []string{},
+		Metadata:   metadata,
+	}
+
+	if summary.DefaultBranch, err = GetDefaultBranch(repoName); err != nil {
+		return nil, err
+	}
+
+	refs, err := runGitCommand(repoAbsolutePath, "for-each-ref", "--format=%(refname)")
+	if err != nil {
+		return nil, err
+	}
+
+	if refsOut := strings.TrimSpace(string(refs)); refsOut != "" {
+		summary.RefsCount = len(strings.Split(refsOut, "\n"))
+	}
+
+	// an empty repo has no commit on HEAD yet
+	if _, err := runGitCommand(repoAbsolutePath, "rev-parse", "--verify", "--quiet", "HEAD^{commit}"); err != nil {
+		return summary, nil
+	}
+
+	lastCommit, err := runGitCommand(repoAbsolutePath, "log", "-1", "--date=iso-strict", "--format=%H%x00%cd", "HEAD")
+	if err != nil {
+		return nil, err
+	}
+
+	if commitPieces := strings.SplitN(strings.TrimSpace(string(lastCommit)), "\x00", 2); len(commitPieces) == 2 {
+		summary.LastCommit = &LastCommitInfo{
+			Commit: commitPieces[0],
+			Date:   commitPieces[1],
+		}
+	}
+
+	return summary, nil
+}
+
+// ListRepos list summary of repos sorted by given field, paginated with page starting from 0
+func ListRepos(sortBy string, descending bool, pageNum int64, perPage int64) ([]RepoSummary, int, error) {
+	repoNames, err := ListRepoNames()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	sortKeys := make(map[string]int64, len(repoNames))
+
+	for _, repoName := range repoNames {
+		switch sortBy {
+		case RepoSortBy_Created:
+			// a repo with unreadable metadata is sorted first, its summary carries the error
+			if metadata, err := GetRepoMetadata(repoName); err == nil {
+				sortKeys[repoName] = metadata.CreatedAt.UnixNano()
+			}
+		case RepoSortBy_LastPush:
+			if lastPushAt := getRepoLastPushAt(GetRepoAbsolutePath(repoName)); lastPushAt != nil {
+				sortKeys[repoName] = lastPushAt.UnixNano()
+			}
+		}
+	}
+
+	sort.SliceStable(repoNames, func(i, j int) bool {
+		first, second := repoNames[i], repoNames[j]
+		if descending {
+			first, second = second, first
+		}
+
+		if sortKeys[first] != sortKeys[second] {
+			return sortKeys[first] < sortKeys[second]
+		}
+
+		return first < second
+	})
+
+	total := len(repoNames)
+	start, end := PageBounds(total, pageNum, perPage)
+
+	if start == end {
+		return []RepoSummary{}, total, nil
+	}
+
+	summaries := make([]RepoSummary, 0, end-start)
+
+	forks := make(map[string][]string)
+
+	for _, repoName := range repoNames {
+		if parent := GetRepoParent(repoName); parent != "" {
+			forks[parent] = append(forks[parent], repoName)
+		}
+	}
+
+	for _, repoName := range repoNames[start:end] {
+		summary, err := GetRepoSummary(repoName)
+		if err != nil {
+			// a single broken repo, like one with a detached HEAD, is listed with the error
+			// instead of failing the whole listing
+			summary = &RepoSummary{
+				Name:   repoName,
+				Forks:  []string{},
+				Parent: GetRepoParent(repoName),
+				Error:  err.Error(),
+			}
+		}
+
+		if repoForks, ok := forks[repoName]; ok {
+			sort.Strings(repoForks)
+			summary.Forks = repoForks
+		}
+
+		summaries = append(summaries, *summary)
+	}
+
+	return summaries, total, nil
+}
+
+// IsRepoSortByValid check if repos can be sorted by the given field
+func IsRepoSortByValid(sortBy string) bool {
+	return sortBy == RepoSortBy_Name || sortBy == RepoSortBy_Created || sortBy == RepoSortBy_LastPush
+}
+
+// PageBounds start and end index of the page in a listing of total items, pageNum starts
+// from 0, pages past the end are empty even when pageNum * perPage would overflow
+func PageBounds(total int, pageNum int64, perPage int64) (int, int) {
+	if pageNum < 0 || perPage < 1 || pageNum > int64(total)/perPage {
+		return total, total
+	}
+
+	start := pageNum * perPage
+
+	end := start + perPage
+	if end > int64(total) {
+		end = int64(total)
+	}
+
+	return int(start), int(end)
+}
+
+// ParsePerPage parse the per page count and limit it between 1 and max
+func ParsePerPage(perPage string, defaultCount int64, maxCount int64) int64 {
+	count, err := strconv.ParseInt(perPage, 10, 64)
+
+	if err != nil || count < 1 {
+		return defaultCount
+	}
+
+	if count > maxCount {
+		return maxCount
+	}
+
+	return count
+}
+
+// GetDefaultBranch branch which HEAD of the repo points to
+func GetDefaultBranch(repoName string) (string, error) {
+	headRef, err := runGitCommand(GetRepoAbsolutePath(repoName), "symbolic-ref", "--short", "HEAD")
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(headRef)), nil
+}
+
+// SetDefaultBranch point HEAD of the repo to an existing branch, returns the previous default branch
+func SetDefaultBranch(repoName string, branchName string) (string, error) {
+	if !IsBranchNameValid(branchName) {
+		return "", ErrInvalidBranchName
+	}
+
+	repoAbsolutePath := GetRepoAbsolutePath(repoName)
+
+	if _, err := runGitCommand(repoAbsolutePath, "show-ref", "--verify", "--quiet", "refs/heads/"+branchName); err != nil {
+		return "", ErrRefNotFound
+	}
+
+	// a detached HEAD has no branch, which is a state this is meant to fix
+	oldBranchName, err := runGitCommand(repoAbsolutePath, "symbolic-ref", "--quiet", "--short", "HEAD")
+
+	var exitErr *exec.ExitError
+	if err != nil && !(errors.As(err, &exitErr) && exitErr.ExitCode() == 1) {
+		return "", err
+	}
+
+	if _, err := runGitCommand(repoAbsolutePath, "symbolic-ref", "HEAD", "refs/heads/"+branchName); err != nil {
+		return "", err
+	}
+
+	return strings.TrimSpace(string(oldBranchName)), nil
+}
@@ -0,0 +1,284 @@
+package utils
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// ErrInvalidSearchQuery returned when the search query is empty or not a valid regex
+var ErrInvalidSearchQuery = errors.New("invalid search query")
+
+// SearchOptions query and filters of a code search
+type SearchOptions struct {
+	Query      string
+	Ref        string
+	Regex      bool
+	IgnoreCase bool
+	Paths      []string
+	Context    int
+	MaxResults int64
+}
+
+// SearchLine a line of a file with its line number
+type SearchLine struct {
+	LineNumber int    `json:"lineNumber"`
+	Line       string `json:"line"`
+}
+
+// SearchResult a matched line with the lines around it
+type SearchResult struct {
+	Path string `json:"path"`
+	SearchLine
+	Before []SearchLine `json:"before"`
+	After  []SearchLine `json:"after"`
+}
+
+// SearchResults matches of a search in a commit, Truncated is set when there were
+// more matches than MaxResults
+type SearchResults struct {
+	Ref       string         `json:"ref"`
+	Commit    string         `json:"commit"`
+	Results   []SearchResult `json:"results"`
+	Truncated bool           `json:"truncated"`
+}
+
+// searchLineMatch a line printed by git grep -n -z
+type searchLineMatch struct {
+	path string
+	SearchLine
+}
+
+// emptyTreeSha the empty tree, which git knows of in every repo
+const emptyTreeSha = "4b825dc642cb6eb9a060e54bf8d69288fbee4904"
+
+// getSearchArgs git grep args for the options, the query always goes through -e so
+// it is never read as an option
+func getSearchArgs(repoAbsolutePath string, options SearchOptions) ([]string, error) {
+	if options.Query == "" {
+		return nil, ErrInvalidSearchQuery
+	}
+
+	args := []string{"grep", "-I", "-n", "-z", "--no-color"}
+
+	if options.Regex {
+		args = append(args, "-E")
+	} else {
+		args = append(args, "-F")
+	}
+
+	if options.IgnoreCase {
+		args = append(args, "-i")
+	}
+
+	args = append(args, "-e", options.Query)
+
+	if options.Regex {
+		if err := checkSearchRegex(repoAbsolutePath, args); err != nil {
+			return nil, err
+		}
+	}
+
+	return args, nil
+}
+
+// checkSearchRegex compile the regex the way git grep does by searching the empty tree,
+// Go's regexp understands a different syntax than the POSIX extended regex of git
+func checkSearchRegex(repoAbsolutePath string, searchArgs []string) error {
+	_, err := runGitCommand(repoAbsolutePath, append(append([]string{}, searchArgs...), emptyTreeSha)...)
+
+	// nothing can match in the empty tree, a valid regex makes grep exit with 1
+	var exitErr *exec.ExitError
+	if err == nil || errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		return nil
+	}
+
+	if strings.Contains(err.Error(), "-e option") {
+		return fmt.Errorf("%w: %s", ErrInvalidSearchQuery, strings.TrimPrefix(err.Error(), "fatal: "))
+	}
+
+	return err
+}
+
+// readSearchLines read "<commit>:<path>\0<line number>\0<line>" lines of git grep output,
+// the "--" separators between context groups are skipped, reading stops after maxLines
+func readSearchLines(reader io.Reader, commitSha string, maxLines int64) ([]searchLineMatch, error) {
+	lines := []searchLineMatch{}
+	bufReader := bufio.NewReader(reader)
+
+	for maxLines < 0 || int64(len(lines)) < maxLines {
+		line, err := bufReader.ReadString('\n')
+
+		if line != "" {
+			fields := strings.SplitN(strings.TrimSuffix(line, "\n"), "\x00", 3)
+
+			if len(fields) == 3 {
+				lineNumber, convErr := strconv.Atoi(fields[1])
+				if convErr != nil {
+					return nil, errors.New("cannot parse search results")
+				}
+
+				lines = append(lines, searchLineMatch{
+					path:       strings.TrimPrefix(fields[0], commitSha+":"),
+					SearchLine: SearchLine{LineNumber: lineNumber, Line: fields[2]},
+				})
+			}
+		}
+
+		if err == io.EOF {
+			break
+		}
+
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return lines, nil
+}
+
+// closeGrep wait for git grep, which exits with 1 when nothing matched
+func closeGrep(grep io.ReadCloser, readFully bool) error {
+	err := grep.Close()
+
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == 1 {
+		return nil
+	}
+
+	// grep fails on the closed pipe when its output is not read fully
+	if !readFully {
+		return nil
+	}
+
+	return err
+}
+
+// SearchRepo search the files of a commit with git grep
+func SearchRepo(repoName string, options SearchOptions) (*SearchResults, error) {
+	repoAbsolutePath := GetRepoAbsolutePath(repoName)
+
+	searchArgs, err := getSearchArgs(repoAbsolutePath, options)
+	if err != nil {
+		return nil, err
+	}
+
+	ref := options.Ref
+	if ref == "" {
+		ref = "HEAD"
+	}
+
+	commitSha, err := resolveCommit(repoAbsolutePath, ref)
+	if err != nil {
+		return nil, err
+	}
+
+	pathspec := []string{"--"}
+
+	for _, pathGlob := range options.Paths {
+		cleanGlob, err := cleanTreePath(pathGlob)
+		if err != nil {
+			return nil, err
+		}
+
+		if cleanGlob != "" {
+			pathspec = append(pathspec, ":(glob)"+cleanGlob)
+		}
+	}
+
+	grep, err := startGitCommand(repoAbsolutePath, append(append(searchArgs, commitSha), pathspec...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	// one more than the cap tells if results were left out
+	matches, err := readSearchLines(grep, commitSha, options.MaxResults+1)
+
+	if closeErr := closeGrep(grep, int64(len(matches)) <= options.MaxResults); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	results := &SearchResults{Ref: ref, Commit: commitSha, Results: []SearchResult{}}
+
+	if int64(len(matches)) > options.MaxResults {
+		matches = matches[:options.MaxResults]
+		results.Truncated = true
+	}
+
+	fileLines, err := getSearchContext(repoAbsolutePath, commitSha, searchArgs, matches, options.Context)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, match := range matches {
+		result := SearchResult{Path: match.path, SearchLine: match.SearchLine, Before: []SearchLine{}, After: []SearchLine{}}
+		lines := fileLines[match.path]
+
+		for lineNumber := match.LineNumber - options.Context; lineNumber < match.LineNumber; lineNumber++ {
+			if line, ok := lines[lineNumber]; ok {
+				result.Before = append(result.Before, SearchLine{LineNumber: lineNumber, Line: line})
+			}
+		}
+
+		for lineNumber := match.LineNumber + 1; lineNumber <= match.LineNumber+options.Context; lineNumber++ {
+			if line, ok := lines[lineNumber]; ok {
+				result.After = append(result.After, SearchLine{LineNumber: lineNumber, Line: line})
+			}
+		}
+
+		results.Results = append(results.Results, result)
+	}
+
+	return results, nil
+}
+
+// getSearchContext lines around the matches keyed by path and line number, git grep -z
+// prints context lines the same way as matched lines so they are read in a second run
+// limited to the matched files
+func getSearchContext(repoAbsolutePath string, commitSha string, searchArgs []string, matches []searchLineMatch, context int) (map[string]map[int]string, error) {
+	fileLines := make(map[string]map[int]string)
+
+	if context <= 0 || len(matches) == 0 {
+		return fileLines, nil
+	}
+
+	args := append(append([]string{}, searchArgs...), "-C", strconv.Itoa(context), commitSha, "--")
+
+	for _, match := range matches {
+		if _, ok := fileLines[match.path]; !ok {
+			fileLines[match.path] = make(map[int]string)
+			args = append(args, ":(literal)"+match.path)
+		}
+	}
+
+	grep, err := startGitCommand(repoAbsolutePath, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	lines, err := readSearchLines(grep, commitSha, -1)
+
+	if closeErr := closeGrep(grep, true); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, line := range lines {
+		if _, ok := fileLines[line.path]; ok {
+			fileLines[line.path][line.LineNumber] = line.Line
+		}
+	}
+
+	return fileLines, nil
+}
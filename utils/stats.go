@@ -0,0 +1,250 @@
+package utils
+
+import (
+	"bufio"
+	"errors"
+	"gitbox/config"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Contributor commits and changed lines of an author, authors are merged using .mailmap
+type Contributor struct {
+	Name      string `json:"name"`
+	Email     string `json:"email"`
+	Commits   int    `json:"commits"`
+	Additions int    `json:"additions"`
+	Deletions int    `json:"deletions"`
+}
+
+// WeeklyActivity commits in the week starting on Monday, in UTC
+type WeeklyActivity struct {
+	Week    string `json:"week"`
+	Commits int    `json:"commits"`
+}
+
+// FileActivity number of commits which changed the file
+type FileActivity struct {
+	Path    string `json:"path"`
+	Commits int    `json:"commits"`
+}
+
+// RepoStats history stats of a commit and all its ancestors
+type RepoStats struct {
+	Commit         string           `json:"commit"`
+	TotalCommits   int              `json:"totalCommits"`
+	Contributors   []Contributor    `json:"contributors"`
+	WeeklyActivity []WeeklyActivity `json:"weeklyActivity"`
+	HotFiles       []FileActivity   `json:"hotFiles"`
+}
+
+// statsCommitFormat starts every commit with \x01 followed by its NUL separated fields,
+// the NUL separated numstat of the commit comes after them
+const statsCommitFormat string = "--format=%x01%H%x00%aN%x00%aE%x00%at"
+
+var (
+	// repoStatsCache last computed stats of each repo, valid while the commit stays the same
+	repoStatsCache     = make(map[string]*RepoStats)
+	repoStatsCacheLock sync.Mutex
+)
+
+// getCachedRepoStats stats of the repo if they were computed for the commit
+func getCachedRepoStats(repoName string, commitSha string) *RepoStats {
+	repoStatsCacheLock.Lock()
+	defer repoStatsCacheLock.Unlock()
+
+	if stats, ok := repoStatsCache[repoName]; ok && stats.Commit == commitSha {
+		return stats
+	}
+
+	return nil
+}
+
+func setCachedRepoStats(repoName string, stats *RepoStats) {
+	repoStatsCacheLock.Lock()
+	defer repoStatsCacheLock.Unlock()
+
+	repoStatsCache[repoName] = stats
+}
+
+func newRepoStats(commitSha string) *RepoStats {
+	return &RepoStats{
+		Commit:         commitSha,
+		Contributors:   []Contributor{},
+		WeeklyActivity: []WeeklyActivity{},
+		HotFiles:       []FileActivity{},
+	}
+}
+
+// getWeekStart Monday of the week of the unix time, in UTC
+func getWeekStart(unixTime int64) string {
+	date := time.Unix(unixTime, 0).UTC()
+	daysSinceMonday := (int(date.Weekday()) + 6) % 7
+
+	return date.AddDate(0, 0, -daysSinceMonday).Format("2006-01-02")
+}
+
+// repoStatsBuilder accumulate stats while the log is read
+type repoStatsBuilder struct {
+	stats        *RepoStats
+	contributors map[string]*Contributor
+	weeks        map[string]int
+	files        map[string]int
+}
+
+// addCommit add a "<sha>\0<name>\0<email>\0<time>\0\n<added>\t<deleted>\t<path>\0..." commit
+func (builder *repoStatsBuilder) addCommit(commit string) error {
+	fields := strings.Split(commit, "\x00")
+	if len(fields) < 4 {
+		return errors.New("cannot parse commit stats")
+	}
+
+	authorTime, err := strconv.ParseInt(fields[3], 10, 64)
+	if err != nil {
+		return errors.New("cannot parse commit stats")
+	}
+
+	// authors with the same email are the same contributor after .mailmap is applied
+	contributorKey := strings.ToLower(fields[2])
+
+	contributor, ok := builder.contributors[contributorKey]
+	if !ok {
+		contributor = &Contributor{Name: fields[1], Email: fields[2]}
+		builder.contributors[contributorKey] = contributor
+	}
+
+	contributor.Commits++
+	builder.stats.TotalCommits++
+	builder.weeks[getWeekStart(authorTime)]++
+
+	for _, stat := range fields[4:] {
+		statPieces := strings.SplitN(strings.TrimPrefix(stat, "\n"), "\t", 3)
+		if len(statPieces) != 3 {
+			continue
+		}
+
+		builder.files[statPieces[2]]++
+
+		// binary files have "-" as counts
+		additions, _ := strconv.Atoi(statPieces[0])
+		deletions, _ := strconv.Atoi(statPieces[1])
+
+		contributor.Additions += additions
+		contributor.Deletions += deletions
+	}
+
+	return nil
+}
+
+// build sort the accumulated stats, contributors and files by commits and weeks by date
+func (builder *repoStatsBuilder) build() *RepoStats {
+	stats := builder.stats
+
+	for _, contributor := range builder.contributors {
+		stats.Contributors = append(stats.Contributors, *contributor)
+	}
+
+	sort.Slice(stats.Contributors, func(i, j int) bool {
+		if stats.Contributors[i].Commits != stats.Contributors[j].Commits {
+			return stats.Contributors[i].Commits > stats.Contributors[j].Commits
+		}
+
+		return stats.Contributors[i].Email < stats.Contributors[j].Email
+	})
+
+	for week, commits := range builder.weeks {
+		stats.WeeklyActivity = append(stats.WeeklyActivity, WeeklyActivity{Week: week, Commits: commits})
+	}
+
+	sort.Slice(stats.WeeklyActivity, func(i, j int) bool {
+		return stats.WeeklyActivity[i].Week < stats.WeeklyActivity[j].Week
+	})
+
+	for filePath, commits := range builder.files {
+		stats.HotFiles = append(stats.HotFiles, FileActivity{Path: filePath, Commits: commits})
+	}
+
+	sort.Slice(stats.HotFiles, func(i, j int) bool {
+		if stats.HotFiles[i].Commits != stats.HotFiles[j].Commits {
+			return stats.HotFiles[i].Commits > stats.HotFiles[j].Commits
+		}
+
+		return stats.HotFiles[i].Path < stats.HotFiles[j].Path
+	})
+
+	if len(stats.HotFiles) > config.StatsHotFilesCount {
+		stats.HotFiles = stats.HotFiles[:config.StatsHotFilesCount]
+	}
+
+	return stats
+}
+
+// GetRepoStats contributors, weekly activity and most changed files of the history
+// of HEAD, computed once per HEAD commit as it reads the whole history, an empty repo has empty stats
+func GetRepoStats(repoName string) (*RepoStats, error) {
+	repoAbsolutePath := GetRepoAbsolutePath(repoName)
+
+	commitSha, err := resolveHead(repoAbsolutePath)
+
+	switch {
+	case errors.Is(err, ErrEmptyRepo):
+		return newRepoStats(""), nil
+	case err != nil:
+		return nil, err
+	}
+
+	if stats := getCachedRepoStats(repoName, commitSha); stats != nil {
+		return stats, nil
+	}
+
+	// in a bare repo .mailmap is read from HEAD
+	gitLog, err := startGitCommand(repoAbsolutePath, "log", "--use-mailmap", "--no-renames", "-z", "--numstat", statsCommitFormat, commitSha)
+	if err != nil {
+		return nil, err
+	}
+
+	builder := &repoStatsBuilder{
+		stats:        newRepoStats(commitSha),
+		contributors: make(map[string]*Contributor),
+		weeks:        make(map[string]int),
+		files:        make(map[string]int),
+	}
+
+	reader := bufio.NewReader(gitLog)
+
+	for {
+		commit, readErr := reader.ReadString('\x01')
+		commit = strings.TrimSuffix(commit, "\x01")
+
+		if commit != "" {
+			if err = builder.addCommit(commit); err != nil {
+				break
+			}
+		}
+
+		if readErr != nil {
+			if readErr != io.EOF {
+				err = readErr
+			}
+
+			break
+		}
+	}
+
+	if closeErr := gitLog.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	stats := builder.build()
+	setCachedRepoStats(repoName, stats)
+
+	return stats, nil
+}
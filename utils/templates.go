@@ -0,0 +1,300 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// RepoTemplate files the first commit of a new repo is created with
+type RepoTemplate struct {
+	// Readme add a README.md with repo name as title
+	Readme bool `json:"readme"`
+
+	// Gitignore name of the .gitignore template, one of GitignoreTemplates
+	Gitignore string `json:"gitignore"`
+
+	// License name of the LICENSE template, one of LicenseTemplates
+	License string `json:"license"`
+
+	// Repo existing repo whose default branch files are copied, without its history
+	Repo string `json:"repo"`
+
+	// Author of the initial commit, server identity is used if empty
+	Author *Author `json:"author"`
+}
+
+// ErrUnknownTemplate returned when a gitignore or license template does not exist
+var ErrUnknownTemplate = errors.New("unknown template")
+
+// GitignoreTemplates .gitignore contents which can be used while creating a repo
+var GitignoreTemplates = map[string]string{
+	"Go": `# Binaries
+*.exe
+*.dll
+*.so
+*.dylib
+
+# Test binary, built with go test -c
+*.test
+
+# Output of the go coverage tool
+*.out
+
+vendor/
+`,
+	"Node": `node_modules/
+npm-debug.log*
+yarn-debug.log*
+yarn-error.log*
+coverage/
+dist/
+.env
+`,
+	"Python": `__pycache__/
+*.py[cod]
+*.egg-info/
+build/
+dist/
+.venv/
+venv/
+.env
+`,
+}
+
+// LicenseTemplates LICENSE contents which can be used while creating a repo,
+// [year] and [fullname] are replaced while creating the file
+var LicenseTemplates = map[string]string{
+	"MIT": `MIT License
+
+Copyright (c) [year] [fullname]
+
+Permission is hereby granted, free of charge, to any person obtaining a copy
+of this software and associated documentation files (the "Software"), to deal
+in the Software without restriction, including without limitation the rights
+to use, copy, modify, merge, publish, distribute, sublicense, and/or sell
+copies of the Software, and to permit persons to whom the Software is
+furnished to do so, subject to the following conditions:
+
+The above copyright notice and this permission notice shall be included in all
+copies or substantial portions of the Software.
+
+THE SOFTWARE IS PROVIDED "AS IS", WITHOUT WARRANTY OF ANY KIND, EXPRESS OR
+IMPLIED, INCLUDING BUT NOT LIMITED TO THE WARRANTIES OF MERCHANTABILITY,
+FITNESS FOR A PARTICULAR PURPOSE AND NONINFRINGEMENT. IN NO EVENT SHALL THE
+AUTHORS OR COPYRIGHT HOLDERS BE LIABLE FOR ANY CLAIM, DAMAGES OR OTHER
+LIABILITY, WHETHER IN AN ACTION OF CONTRACT, TORT OR OTHERWISE, ARISING FROM,
+OUT OF OR IN CONNECTION WITH THE SOFTWARE OR THE USE OR OTHER DEALINGS IN THE
+SOFTWARE.
+`,
+	"ISC": `ISC License
+
+Copyright (c) [year] [fullname]
+
+Permission to use, copy, modify, and/or distribute this software for any
+purpose with or without fee is hereby granted, provided that the above
+copyright notice and this permission notice appear in all copies.
+
+THE SOFTWARE IS PROVIDED "AS IS" AND THE AUTHOR DISCLAIMS ALL WARRANTIES
+WITH REGARD TO THIS SOFTWARE INCLUDING ALL IMPLIED WARRANTIES OF
+MERCHANTABILITY AND FITNESS. IN NO EVENT SHALL THE AUTHOR BE LIABLE FOR
+ANY SPECIAL, DIRECT, INDIRECT, OR CONSEQUENTIAL DAMAGES OR ANY DAMAGES
+WHATSOEVER RESULTING FROM LOSS OF USE, DATA OR PROFITS, WHETHER IN AN
+ACTION OF CONTRACT, NEGLIGENCE OR OTHER TORTIOUS ACTION, ARISING OUT OF
+OR IN CONNECTION WITH THE USE OR PERFORMANCE OF THIS SOFTWARE.
+`,
+}
+
+// IsEmpty check if the template adds no files at all
+func (template *RepoTemplate) IsEmpty() bool {
+	return template == nil || (!template.Readme && template.Gitignore == "" && template.License == "" && template.Repo == "")
+}
+
+// Validate check that all the templates asked for exist
+func (template *RepoTemplate) Validate() error {
+	if template.IsEmpty() {
+		return nil
+	}
+
+	if _, ok := GitignoreTemplates[template.Gitignore]; template.Gitignore != "" && !ok {
+		return fmt.Errorf("%w: gitignore %s", ErrUnknownTemplate, template.Gitignore)
+	}
+
+	if _, ok := LicenseTemplates[template.License]; template.License != "" && !ok {
+		return fmt.Errorf("%w: license %s", ErrUnknownTemplate, template.License)
+	}
+
+	if template.Repo != "" && (!IsRepoNameValid(template.Repo) || !RepoExists(template.Repo)) {
+		return fmt.Errorf("%w: repo %s", ErrUnknownTemplate, template.Repo)
+	}
+
+	return nil
+}
+
+// templateFiles the files generated from the gitignore, license and readme templates
+func (template *RepoTemplate) templateFiles(repoName string) map[string]string {
+	files := make(map[string]string)
+
+	if template.Readme {
+		files["README.md"] = fmt.Sprintf("# %s\n", repoName)
+	}
+
+	if template.Gitignore != "" {
+		files[".gitignore"] = GitignoreTemplates[template.Gitignore]
+	}
+
+	if template.License != "" {
+		fullName := repoName
+		if template.Author != nil && template.Author.Name != "" {
+			fullName = template.Author.Name
+		}
+
+		files["LICENSE"] = strings.NewReplacer(
+			"[year]", fmt.Sprintf("%d", time.Now().Year()),
+			"[fullname]", fullName,
+		).Replace(LicenseTemplates[template.License])
+	}
+
+	return files
+}
+
+// copyTemplateTree copy the objects of the template repo default branch tree into the repo
+func copyTemplateTree(repoAbsolutePath string, templateRepoName string) (string, error) {
+	templateAbsolutePath := GetRepoAbsolutePath(templateRepoName)
+
+	treeSha, err := runGitCommand(templateAbsolutePath, "rev-parse", "--verify", "--quiet", "HEAD^{tree}")
+	if err != nil {
+		return "", fmt.Errorf("%w: template repo %s", ErrEmptyRepo, templateRepoName)
+	}
+
+	objects, err := runGitCommand(templateAbsolutePath, "rev-list", "--objects", strings.TrimSpace(string(treeSha)))
+	if err != nil {
+		return "", err
+	}
+
+	// pack only the tree objects in template repo and unpack them in the new repo
+	packCommand := exec.Command("git", "pack-objects", "--stdout", "-q")
+	packCommand.Dir = templateAbsolutePath
+	packCommand.Stdin = bytes.NewReader(objects)
+
+	unpackCommand := exec.Command("git", "unpack-objects", "-q")
+	unpackCommand.Dir = repoAbsolutePath
+
+	if unpackCommand.Stdin, err = packCommand.StdoutPipe(); err != nil {
+		return "", err
+	}
+
+	if err := unpackCommand.Start(); err != nil {
+		return "", err
+	}
+
+	packErr := packCommand.Run()
+
+	if err := unpackCommand.Wait(); err != nil {
+		return "", err
+	}
+
+	if packErr != nil {
+		return "", packErr
+	}
+
+	return strings.TrimSpace(string(treeSha)), nil
+}
+
+// createInitialCommit create the first commit of the empty repo on the branch from template files
+func createInitialCommit(repoName string, branchName string, template *RepoTemplate) (string, error) {
+	repoAbsolutePath := GetRepoAbsolutePath(repoName)
+	entries := []TreeEntry{}
+
+	if template.Repo != "" {
+		templateTreeSha, err := copyTemplateTree(repoAbsolutePath, template.Repo)
+		if err != nil {
+			return "", err
+		}
+
+		if entries, err = readTree(repoAbsolutePath, templateTreeSha); err != nil {
+			return "", err
+		}
+	}
+
+	for fileName, content := range template.templateFiles(repoName) {
+		blobSha, err := writeBlob(repoAbsolutePath, []byte(content))
+		if err != nil {
+			return "", err
+		}
+
+		fileEntry := TreeEntry{Mode: "100644", Type: "blob", Sha: blobSha, Name: fileName}
+		replaced := false
+
+		// generated files win over the files of the template repo
+		for i, entry := range entries {
+			if entry.Name == fileName {
+				entries[i] = fileEntry
+				replaced = true
+			}
+		}
+
+		if !replaced {
+			entries = append(entries, fileEntry)
+		}
+	}
+
+	treeSha, err := writeTree(repoAbsolutePath, entries)
+	if err != nil {
+		return "", err
+	}
+
+	commitSha, err := commitTree(repoAbsolutePath, treeSha, nil, "Initial commit", template.Author)
+	if err != nil {
+		return "", err
+	}
+
+	if err := updateRef(repoAbsolutePath, "refs/heads/"+branchName, commitSha, ""); err != nil {
+		return "", err
+	}
+
+	return commitSha, nil
+}
+
+// CreateNewRepoFromTemplate initialize a bare git repo with HEAD on the branch given, and when
+// a template is given create the first commit on it. The repo is removed again on any failure
+func CreateNewRepoFromTemplate(repoName string, branchName string, template *RepoTemplate) (string, error) {
+	if err := CreateNewRepo(repoName); err != nil {
+		return "", err
+	}
+
+	repoAbsolutePath := GetRepoAbsolutePath(repoName)
+	commitSha := ""
+
+	err := func() error {
+		if branchName != "" {
+			if _, err := runGitCommand(repoAbsolutePath, "symbolic-ref", "HEAD", "refs/heads/"+branchName); err != nil {
+				return err
+			}
+		}
+
+		if template.IsEmpty() {
+			return nil
+		}
+
+		headRef, err := runGitCommand(repoAbsolutePath, "symbolic-ref", "--short", "HEAD")
+		if err != nil {
+			return err
+		}
+
+		commitSha, err = createInitialCommit(repoName, strings.TrimSpace(string(headRef)), template)
+
+		return err
+	}()
+
+	if err != nil {
+		_ = RemoveRepo(repoName)
+
+		return "", err
+	}
+
+	return commitSha, nil
+}
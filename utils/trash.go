@@ -0,0 +1,201 @@
+package utils
+
+import (
+	"encoding/json"
+	"errors"
+	"gitbox/config"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// TrashItem a deleted repo which can still be restored until it is purged
+type TrashItem struct {
+	ID        string    `json:"id"`
+	RepoName  string    `json:"repoName"`
+	DeletedAt time.Time `json:"deletedAt"`
+	PurgeAt   time.Time `json:"purgeAt"`
+}
+
+// ErrTrashItemNotFound returned when no trash item exists with the given id
+var ErrTrashItemNotFound = errors.New("trash item not found")
+
+var trashIDCheckRegEx = regexp.MustCompile(`^[0-9]+$`).MatchString
+
+const (
+	trashInfoFileName = "trash.json"
+	trashRepoDirName  = "repo"
+)
+
+// GetTrashDirPath Get absolute path of the trash dir in repo base dir
+func GetTrashDirPath() string {
+	return path.Join(config.REPO_BASE_DIR, config.TrashDirName)
+}
+
+func getTrashItemPath(id string) string {
+	return path.Join(GetTrashDirPath(), id)
+}
+
+// MoveRepoToTrash move the repo into trash from where it can be restored later
+func MoveRepoToTrash(repoName string) (*TrashItem, error) {
+	// forks borrow objects of this repo and would break once it is moved
+	if err := DetachRepoForks(repoName); err != nil {
+		return nil, err
+	}
+
+	deletedAt := time.Now().UTC()
+	item := &TrashItem{
+		ID:        strconv.FormatInt(deletedAt.UnixNano(), 10),
+		RepoName:  repoName,
+		DeletedAt: deletedAt,
+		PurgeAt:   deletedAt.Add(config.TRASH_RETENTION),
+	}
+
+	itemPath := getTrashItemPath(item.ID)
+
+	if err := os.MkdirAll(itemPath, 0700); err != nil {
+		return nil, err
+	}
+
+	itemJSON, err := json.Marshal(item)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ioutil.WriteFile(path.Join(itemPath, trashInfoFileName), itemJSON, 0600); err != nil {
+		_ = RemoveRepoAtPath(itemPath)
+		return nil, err
+	}
+
+	if err := os.Rename(GetRepoAbsolutePath(repoName), path.Join(itemPath, trashRepoDirName)); err != nil {
+		_ = RemoveRepoAtPath(itemPath)
+		return nil, err
+	}
+
+	cleanupNamespaceDir(repoName)
+
+	return item, nil
+}
+
+// GetTrashItem read the info of a single item in trash
+func GetTrashItem(id string) (*TrashItem, error) {
+	if !trashIDCheckRegEx(id) {
+		return nil, ErrTrashItemNotFound
+	}
+
+	itemJSON, err := ioutil.ReadFile(path.Join(getTrashItemPath(id), trashInfoFileName))
+	if os.IsNotExist(err) {
+		return nil, ErrTrashItemNotFound
+	} else if err != nil {
+		return nil, err
+	}
+
+	var item TrashItem
+
+	if err := json.Unmarshal(itemJSON, &item); err != nil {
+		return nil, err
+	}
+
+	item.ID = id
+	item.PurgeAt = item.DeletedAt.Add(config.TRASH_RETENTION)
+
+	return &item, nil
+}
+
+// ListTrash list all repos in trash, most recently deleted first
+func ListTrash() ([]TrashItem, error) {
+	entries, err := ioutil.ReadDir(GetTrashDirPath())
+	if os.IsNotExist(err) {
+		return []TrashItem{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	items := []TrashItem{}
+
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+
+		item, err := GetTrashItem(entry.Name())
+		if err != nil {
+			continue
+		}
+
+		items = append(items, *item)
+	}
+
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].DeletedAt.After(items[j].DeletedAt)
+	})
+
+	return items, nil
+}
+
+// RestoreRepoFromTrash move the repo back to its original name
+func RestoreRepoFromTrash(id string) (*TrashItem, error) {
+	item, err := GetTrashItem(id)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := CheckRepoExists(item.RepoName); err != nil {
+		return nil, err
+	}
+
+	repoAbsolutePath := GetRepoAbsolutePath(item.RepoName)
+
+	if err := os.MkdirAll(path.Dir(repoAbsolutePath), 0700); err != nil {
+		return nil, err
+	}
+
+	if err := os.Rename(path.Join(getTrashItemPath(id), trashRepoDirName), repoAbsolutePath); err != nil {
+		cleanupNamespaceDir(item.RepoName)
+		return nil, err
+	}
+
+	if err := RemoveRepoAtPath(getTrashItemPath(id)); err != nil {
+		return nil, err
+	}
+
+	return item, nil
+}
+
+// PurgeTrashItem permanently remove a repo from trash
+func PurgeTrashItem(id string) error {
+	if _, err := GetTrashItem(id); err != nil {
+		return err
+	}
+
+	return RemoveRepoAtPath(getTrashItemPath(id))
+}
+
+// PurgeExpiredTrash permanently remove repos which are in trash for longer than retention time
+func PurgeExpiredTrash() ([]TrashItem, error) {
+	items, err := ListTrash()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	purgedItems := []TrashItem{}
+
+	for _, item := range items {
+		if item.PurgeAt.After(now) {
+			continue
+		}
+
+		if err := RemoveRepoAtPath(getTrashItemPath(item.ID)); err != nil {
+			return purgedItems, err
+		}
+
+		purgedItems = append(purgedItems, item)
+	}
+
+	return purgedItems, nil
+}
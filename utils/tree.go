@@ -0,0 +1,201 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// ErrPathNotFound returned when a path does not exist in the tree of a commit
+var ErrPathNotFound = errors.New("path not found")
+
+// ErrNotADirectory returned when a directory listing is asked for a file
+var ErrNotADirectory = errors.New("path is not a directory")
+
+// ErrNotAFile returned when file content is asked for a directory
+var ErrNotAFile = errors.New("path is not a file")
+
+// RefPath a ref resolved to its commit along with a path inside the commit tree
+type RefPath struct {
+	Ref    string `json:"ref"`
+	Commit string `json:"commit"`
+	Path   string `json:"path"`
+}
+
+// cleanTreePath normalize a path inside a git tree, paths escaping the tree are rejected
+func cleanTreePath(treePath string) (string, error) {
+	pathPieces := []string{}
+
+	for _, piece := range strings.Split(treePath, "/") {
+		switch piece {
+		case "":
+			continue
+		case ".", "..":
+			return "", ErrPathNotFound
+		default:
+			pathPieces = append(pathPieces, piece)
+		}
+	}
+
+	return strings.Join(pathPieces, "/"), nil
+}
+
+// ResolveRefPath split "ref/path" where the ref may itself contain slashes,
+// the shortest prefix which resolves to a commit is used as the ref
+func ResolveRefPath(repoName string, refAndPath string) (*RefPath, error) {
+	repoAbsolutePath := GetRepoAbsolutePath(repoName)
+	pathPieces := strings.Split(strings.Trim(refAndPath, "/"), "/")
+
+	for i := 1; i <= len(pathPieces); i++ {
+		ref := strings.Join(pathPieces[:i], "/")
+
+		commitSha, err := resolveCommit(repoAbsolutePath, ref)
+		if errors.Is(err, ErrRefNotFound) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+
+		treePath, err := cleanTreePath(strings.Join(pathPieces[i:], "/"))
+		if err != nil {
+			return nil, err
+		}
+
+		return &RefPath{Ref: ref, Commit: commitSha, Path: treePath}, nil
+	}
+
+	return nil, ErrRefNotFound
+}
+
+// getObjectType type of the object at path in the commit, blob, tree or commit for submodules
+func getObjectType(repoAbsolutePath string, refPath *RefPath) (string, error) {
+	objectType, err := runGitCommand(repoAbsolutePath, "cat-file", "-t", refPath.Commit+":"+refPath.Path)
+	if err != nil {
+		return "", ErrPathNotFound
+	}
+
+	return strings.TrimSpace(string(objectType)), nil
+}
+
+// GetTreeEntries list the directory at the path in the commit with size of each file
+func GetTreeEntries(repoName string, refPath *RefPath) ([]TreeEntry, error) {
+	repoAbsolutePath := GetRepoAbsolutePath(repoName)
+
+	objectType, err := getObjectType(repoAbsolutePath, refPath)
+	if err != nil {
+		return nil, err
+	}
+
+	if objectType != "tree" {
+		return nil, ErrNotADirectory
+	}
+
+	out, err := runGitCommand(repoAbsolutePath, "ls-tree", "-l", "-z", refPath.Commit+":"+refPath.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	entries := []TreeEntry{}
+
+	for _, line := range strings.Split(string(out), "\x00") {
+		// each line is "<mode> <type> <sha> <size>\t<name>", size is "-" for non blobs
+		linePieces := strings.SplitN(line, "\t", 2)
+		if len(linePieces) != 2 {
+			continue
+		}
+
+		fields := strings.Fields(linePieces[0])
+		if len(fields) != 4 {
+			continue
+		}
+
+		entry := TreeEntry{
+			Mode: fields[0],
+			Type: fields[1],
+			Sha:  fields[2],
+			Name: linePieces[1],
+			Path: strings.TrimPrefix(refPath.Path+"/"+linePieces[1], "/"),
+		}
+
+		if size, err := strconv.ParseInt(fields[3], 10, 64); err == nil {
+			entry.Size = &size
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return entries, nil
+}
+
+// BlobInfo a file in the tree of a commit
+type BlobInfo struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+	Sha  string `json:"sha"`
+	Mode string `json:"mode"`
+	Size int64  `json:"size"`
+}
+
+// GetBlobInfo find the file at the path in the commit, along with its size
+func GetBlobInfo(repoName string, refPath *RefPath) (*BlobInfo, error) {
+	repoAbsolutePath := GetRepoAbsolutePath(repoName)
+
+	if refPath.Path == "" {
+		return nil, ErrNotAFile
+	}
+
+	// listing the parent directory gives mode, sha and size of the file in one go
+	out, err := runGitCommand(repoAbsolutePath, "--literal-pathspecs", "ls-tree", "-l", "-z", refPath.Commit, "--", refPath.Path)
+	if err != nil {
+		return nil, err
+	}
+
+	line := strings.TrimSuffix(string(out), "\x00")
+	linePieces := strings.SplitN(line, "\t", 2)
+
+	if len(linePieces) != 2 || linePieces[1] != refPath.Path {
+		return nil, ErrPathNotFound
+	}
+
+	fields := strings.Fields(linePieces[0])
+	if len(fields) != 4 {
+		return nil, ErrPathNotFound
+	}
+
+	if fields[1] != "blob" {
+		return nil, ErrNotAFile
+	}
+
+	size, err := strconv.ParseInt(fields[3], 10, 64)
+	if err != nil {
+		return nil, err
+	}
+
+	return &BlobInfo{
+		Name: path.Base(refPath.Path),
+		Path: refPath.Path,
+		Sha:  fields[2],
+		Mode: fields[0],
+		Size: size,
+	}, nil
+}
+
+// OpenBlob stream the content of the blob, the returned reader has to be closed once done
+func OpenBlob(repoName string, blobSha string) (io.ReadCloser, error) {
+	return startGitCommand(GetRepoAbsolutePath(repoName), "cat-file", "blob", blobSha)
+}
+
+// DetectBlobContentType content type of a file from its first bytes, a file is considered binary
+// when it has a NUL byte in them, same as git does. Text is always served as plain text,
+// so files like html in the repo are never rendered by browsers
+func DetectBlobContentType(sniff []byte) (string, bool) {
+	if bytes.IndexByte(sniff, 0) == -1 {
+		return "text/plain; charset=utf-8", false
+	}
+
+	return http.DetectContentType(sniff), true
+}
@@ -2,14 +2,13 @@ package utils
 
 import (
 	"bytes"
-	"encoding/json"
 	"errors"
-	"fmt"
 	"gitbox/config"
 	"gitbox/models"
 	"os"
 	"os/exec"
 	"path"
+	"path/filepath"
 	"regexp"
 	"strings"
 )
@@ -40,13 +39,24 @@ type CommitItem struct {
 // CommitLogs all commits
 type CommitLogs []CommitItem
 
-var repoCheckRegEx = regexp.MustCompile(`^[a-zA-Z\-_0-9]+$`).MatchString
+var repoCheckRegEx = regexp.MustCompile(`^([a-zA-Z\-_0-9]+/)?[a-zA-Z\-_0-9]+$`).MatchString
 
 const nullSha string = "0000000000000000000000000000000000000000"
 
-// IsRepoNameValid Checks if repo name is valid and contains only alphanumeric chars
+// ErrRepoAlreadyExists returned when a repo with same name is already present
+var ErrRepoAlreadyExists = errors.New("repo with name already exists")
+
+// IsRepoNameValid Checks if repo name is valid and contains only alphanumeric chars,
+// optionally prefixed with the owner namespace as owner/repo
 func IsRepoNameValid(repoName string) bool {
-	return repoCheckRegEx(repoName)
+	if !repoCheckRegEx(repoName) {
+		return false
+	}
+
+	// the regex already rejects dots, this guards against the path escaping repo base dir
+	relativePath, err := filepath.Rel(config.REPO_BASE_DIR, GetRepoAbsolutePath(repoName))
+
+	return err == nil && relativePath != "." && !strings.HasPrefix(relativePath, "..")
 }
 
 // GetRepoAbsolutePath Get absolute repo path in repo base dir
@@ -54,15 +64,27 @@ func GetRepoAbsolutePath(repoName string) string {
 	return path.Join(config.REPO_BASE_DIR, repoName)
 }
 
-// CheckRepoExists Check is repo with name already present
+// RepoExists check if a bare git repo with the name is present, an owner namespace
+// directory holding other repos is not a repo
+func RepoExists(repoName string) bool {
+	return IsBareRepo(GetRepoAbsolutePath(repoName))
+}
+
+// CheckRepoExists Check if the name is free to create or rename a repo to, any existing
+// path with the name or a flat repo with the owner name makes it taken
 func CheckRepoExists(repoName string) error {
 	repoAbsolutePath := path.Join(config.REPO_BASE_DIR, repoName)
 
-	if _, err := os.Stat(repoAbsolutePath); os.IsNotExist(err) {
-		return nil
+	if _, err := os.Stat(repoAbsolutePath); !os.IsNotExist(err) {
+		return ErrRepoAlreadyExists
+	}
+
+	// a namespaced repo cannot be created inside a flat repo with the owner name
+	if namespace := getRepoNamespace(repoName); namespace != "" && IsBareRepo(GetRepoAbsolutePath(namespace)) {
+		return ErrNamespaceTaken
 	}
 
-	return errors.New("repo with name already exists")
+	return nil
 }
 
 // RemoveRepoAtPath remove directory at the path given
@@ -74,6 +96,42 @@ func RemoveRepoAtPath(repoAbsolutePath string) error {
 	return nil
 }
 
+// RemoveRepo remove the repo along with its owner directory if it was the last repo of the owner
+func RemoveRepo(repoName string) error {
+	err := RemoveRepoAtPath(GetRepoAbsolutePath(repoName))
+
+	cleanupNamespaceDir(repoName)
+
+	return err
+}
+
+// RenameRepo move the repo to the new name
+func RenameRepo(oldRepoName string, newRepoName string) error {
+	if err := CheckRepoExists(newRepoName); err != nil {
+		return err
+	}
+
+	forks, err := GetRepoForks(oldRepoName)
+	if err != nil {
+		return err
+	}
+
+	newRepoAbsolutePath := GetRepoAbsolutePath(newRepoName)
+
+	if err := os.MkdirAll(path.Dir(newRepoAbsolutePath), 0700); err != nil {
+		return err
+	}
+
+	if err := os.Rename(GetRepoAbsolutePath(oldRepoName), newRepoAbsolutePath); err != nil {
+		cleanupNamespaceDir(newRepoName)
+		return err
+	}
+
+	cleanupNamespaceDir(oldRepoName)
+
+	return updateForksParent(forks, newRepoName)
+}
+
 // CreateNewRepo initialize a bare git repo with given name
 func CreateNewRepo(repoName string) error {
 	repoAbsolutePath := GetRepoAbsolutePath(repoName)
@@ -92,49 +150,71 @@ func CreateNewRepo(repoName string) error {
 			return err
 		}
 
+		cleanupNamespaceDir(repoName)
+
+		return err
+	}
+
+	if err := initRepoMetadata(repoName, ""); err != nil {
+		_ = RemoveRepo(repoName)
+
 		return err
 	}
 
 	return nil
 }
 
-// GetCommitsLog to fetch commits log as json array
-func GetCommitsLog(repoName string, pageNum int64) ([]CommitItem, error) {
-	pageArg := fmt.Sprintf("-n %d --skip=%d", config.PerPageCommitCount, pageNum*config.PerPageCommitCount)
+// GetCommitsLog to fetch a page of commits log of HEAD or the ref in options,
+// ErrEmptyRepo is returned when the repo has no commits yet
+func GetCommitsLog(repoName string, options LogOptions) (*CommitsLog, error) {
+	repoAbsolutePath := GetRepoAbsolutePath(repoName)
+	commitsLog := &CommitsLog{Commits: []CommitItem{}}
 
-	logCommand := exec.Command(
-		"git",
-		"log",
-		"--date=iso-strict",
-		config.GitLogFormat,
-		pageArg,
-	)
+	if options.After != "" && !isFullSha(options.After) {
+		return nil, ErrInvalidCursor
+	}
 
-	logCommand.Dir = GetRepoAbsolutePath(repoName)
-	out, _ := logCommand.Output()
+	var headSha string
+	var err error
 
-	logOut := strings.Split(string(out), "^^$$^^$$")
+	if options.Ref == "" {
+		headSha, err = resolveHead(repoAbsolutePath)
+	} else {
+		headSha, err = resolveCommit(repoAbsolutePath, options.Ref)
+	}
 
-	var gitCommitList []CommitItem
+	if err != nil {
+		return nil, err
+	}
 
-	var commitItem CommitItem
+	commitsLog.Head = headSha
 
-	for _, singleLog := range logOut {
-		if singleLog == "" {
-			continue
-		}
+	shas, hasMore, err := listLogShas(repoAbsolutePath, headSha, options)
+	if err != nil {
+		return nil, err
+	}
 
-		singleLog = strings.ReplaceAll(strings.TrimSpace(singleLog), "\n", `\n`)
+	if len(shas) == 0 {
+		return commitsLog, nil
+	}
 
-		err := json.Unmarshal([]byte(singleLog), &commitItem)
-		if err != nil {
-			continue
-		}
+	if hasMore {
+		commitsLog.NextCursor = shas[len(shas)-1]
+	}
+
+	args := append([]string{"log", "--no-walk=unsorted", "-z", "--date=iso-strict", commitDetailFormat}, shas...)
 
-		gitCommitList = append(gitCommitList, commitItem)
+	out, err := runGitCommand(repoAbsolutePath, args...)
+	if err != nil {
+		return nil, err
 	}
 
-	return gitCommitList, nil
+	commitsLog.Commits, err = parseCommitItems(string(out))
+	if err != nil {
+		return nil, err
+	}
+
+	return commitsLog, nil
 }
 
 // ParseGitPushMetadata parse the metadat bytearray into a more informative struct
@@ -150,6 +230,20 @@ func ParseGitPushMetadata(metadata []byte) (*models.MetadataInfo, error) {
 	// we have a null character after the ref, remove that
 	ref := string(metadataPieces[2][:len(metadataPieces[2])-1])
 
+	return NewRefUpdateEvent(ref, oldSha, newSha), nil
+}
+
+// NewRefUpdateEvent event of a ref moving from oldSha to newSha, an empty or null sha
+// on either side makes it a create or delete like it would be for a push
+func NewRefUpdateEvent(ref string, oldSha string, newSha string) *models.MetadataInfo {
+	if oldSha == "" {
+		oldSha = nullSha
+	}
+
+	if newSha == "" {
+		newSha = nullSha
+	}
+
 	typeOfPush := ""
 
 	switch {
@@ -166,5 +260,5 @@ func ParseGitPushMetadata(metadata []byte) (*models.MetadataInfo, error) {
 		OldSha: oldSha,
 		NewSha: newSha,
 		Type:   typeOfPush,
-	}, nil
+	}
 }
@@ -1,11 +1,17 @@
 package utils
 
 import (
+	"errors"
 	"gitbox/config"
+	"io/ioutil"
+	"math"
 	"math/rand"
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 	"time"
+	"unicode/utf8"
 )
 
 const charset = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789-_"
@@ -27,7 +33,7 @@ func BenchmarkGetCommitsLogOnTestRepo(b *testing.B) {
 	config.REPO_BASE_DIR = a
 
 	for n := 0; n < b.N; n++ {
-		_, _ = GetCommitsLog("test-repo", 0)
+		_, _ = GetCommitsLog("test-repo", LogOptions{PerPage: config.PerPageCommitCount})
 	}
 }
 
@@ -38,31 +44,324 @@ func BenchmarkGetRepoAbsolutePath(b *testing.B) {
 }
 
 func TestGetCommitsLog(t *testing.T) {
-	config.REPO_BASE_DIR = "/tmp/repos"
+	baseDir, err := ioutil.TempDir("", "gitbox-log")
+	if err != nil {
+		t.Fatalf("error, %v", err)
+	}
 
-	type args struct {
-		repoName string
+	defer os.RemoveAll(baseDir)
+
+	config.REPO_BASE_DIR = baseDir
+
+	if err := CreateNewRepo("empty"); err != nil {
+		t.Fatalf("error, %v", err)
+	}
+
+	if err := CreateNewRepo("hostile"); err != nil {
+		t.Fatalf("error, %v", err)
+	}
+
+	repoAbsolutePath := GetRepoAbsolutePath("hostile")
+
+	treeSha, err := writeTree(repoAbsolutePath, nil)
+	if err != nil {
+		t.Fatalf("error, %v", err)
+	}
+
+	hostileCommits := []struct {
+		message string
+		author  Author
+		want    CommitItem
+	}{
+		{
+			"subject with \"quotes\" and \\backslash\\",
+			Author{Name: `Name "Nick" O'Brien`, Email: "obrien@example.com"},
+			CommitItem{Subject: `subject with "quotes" and \backslash\`},
+		},
+		{
+			"{\"commit\": \"fake\"}^^$$^^$$\n\nbody with separator ^^$$^^$$\n\tand a tab",
+			Author{Name: "Ünïcödé 名前", Email: "unicode@example.com"},
+			CommitItem{Subject: `{"commit": "fake"}^^$$^^$$`, Body: "body with separator ^^$$^^$$\n\tand a tab"},
+		},
+		{
+			"multi line\nsubject\n\n\n\nbody after blank lines\n\n",
+			Author{Name: "Plain", Email: "plain@example.com"},
+			CommitItem{Subject: "multi line subject", Body: "body after blank lines"},
+		},
+	}
+
+	parents := []string{}
+
+	for i := range hostileCommits {
+		commitSha, err := commitTree(repoAbsolutePath, treeSha, parents, hostileCommits[i].message, &hostileCommits[i].author)
+		if err != nil {
+			t.Fatalf("error, %v", err)
+		}
+
+		hostileCommits[i].want.Commit = commitSha
+		parents = []string{commitSha}
+	}
+
+	if err := updateRef(repoAbsolutePath, "refs/heads/master", parents[0], ""); err != nil {
+		t.Fatalf("error, %v", err)
 	}
 
 	tests := []struct {
-		name    string
-		args    args
-		want    []CommitItem
-		wantErr bool
+		name     string
+		repoName string
+		wantErr  bool
+		// specific error expected, nil accepts any error
+		wantErrIs error
 	}{
-		{"1", args{"test"}, nil, false},
+		{"missing repo", "test", true, nil},
+		{"empty repo", "empty", true, ErrEmptyRepo},
+		{"hostile messages", "hostile", false, nil},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := GetCommitsLog(tt.args.repoName, 0)
-			if (err != nil) != tt.wantErr {
-				t.Errorf("GetCommitsLog() error = %v, wantErr %v", err, tt.wantErr)
+			got, err := GetCommitsLog(tt.repoName, LogOptions{PerPage: config.PerPageCommitCount})
+
+			if (err != nil) != tt.wantErr || (tt.wantErrIs != nil && !errors.Is(err, tt.wantErrIs)) {
+				t.Fatalf("GetCommitsLog() error = %v, wantErr %v %v", err, tt.wantErr, tt.wantErrIs)
+			}
+
+			if tt.wantErr {
 				return
 			}
-			if !reflect.DeepEqual(got, tt.want) {
-				t.Errorf("GetCommitsLog() = %v, want %v", got, tt.want)
+
+			if len(got.Commits) != len(hostileCommits) {
+				t.Fatalf("GetCommitsLog() = %v commits, want %v", len(got.Commits), len(hostileCommits))
+			}
+
+			for i, commit := range got.Commits {
+				want := hostileCommits[len(hostileCommits)-1-i]
+
+				if commit.Commit != want.want.Commit || commit.Subject != want.want.Subject || commit.Body != want.want.Body {
+					t.Errorf("GetCommitsLog() commit = %q %q %q, want %q %q %q", commit.Commit, commit.Subject, commit.Body,
+						want.want.Commit, want.want.Subject, want.want.Body)
+				}
+
+				if commit.Author.Name != want.author.Name || commit.Author.Email != want.author.Email || commit.Author.Date == "" {
+					t.Errorf("GetCommitsLog() author = %v, want %v", commit.Author, want.author)
+				}
+			}
+		})
+	}
+
+	// a repo whose HEAD commit object is gone is corrupt, not empty and not missing a ref
+	if err := CreateNewRepo("corrupt"); err != nil {
+		t.Fatalf("error, %v", err)
+	}
+
+	corruptPath := GetRepoAbsolutePath("corrupt")
+
+	commitSha, err := commitTree(corruptPath, treeSha, nil, "lost commit", nil)
+	if err != nil {
+		t.Fatalf("error, %v", err)
+	}
+
+	if err := updateRef(corruptPath, "refs/heads/master", commitSha, ""); err != nil {
+		t.Fatalf("error, %v", err)
+	}
+
+	if err := os.Remove(filepath.Join(corruptPath, "objects", commitSha[:2], commitSha[2:])); err != nil {
+		t.Fatalf("error, %v", err)
+	}
+
+	for _, ref := range []string{"", "master"} {
+		_, err := GetCommitsLog("corrupt", LogOptions{Ref: ref, PerPage: config.PerPageCommitCount})
+
+		if err == nil || errors.Is(err, ErrRefNotFound) || errors.Is(err, ErrEmptyRepo) {
+			t.Errorf("GetCommitsLog() of corrupt repo with ref %q error = %v, want a corrupt repo error", ref, err)
+		}
+	}
+}
+
+func TestIsRepoNameValid(t *testing.T) {
+	tests := []struct {
+		repoName string
+		want     bool
+	}{
+		{"repo", true},
+		{"owner/repo", true},
+		{"owner-1/repo_2", true},
+		{"", false},
+		{"owner/", false},
+		{"/repo", false},
+		{"owner/repo/extra", false},
+		{"..", false},
+		{"owner/../repo", false},
+		{".trash", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.repoName, func(t *testing.T) {
+			if got := IsRepoNameValid(tt.repoName); got != tt.want {
+				t.Errorf("IsRepoNameValid() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveRepoName(t *testing.T) {
+	baseDir, err := ioutil.TempDir("", "gitbox-test")
+	if err != nil {
+		t.Fatalf("error, %v", err)
+	}
+
+	defer os.RemoveAll(baseDir)
+
+	config.REPO_BASE_DIR = baseDir
+
+	for _, repoName := range []string{"flat", "owner/repo"} {
+		if err := CreateNewRepo(repoName); err != nil {
+			t.Fatalf("error, %v", err)
+		}
+	}
+
+	tests := []struct {
+		name              string
+		action            string
+		allowNewNamespace bool
+		wantRepoName      string
+		wantAction        string
+	}{
+		{"flat", "/log", false, "flat", "/log"},
+		{"flat", "", false, "flat", "/"},
+		{"owner", "/repo", false, "owner/repo", "/"},
+		{"owner", "/repo/info/refs", false, "owner/repo", "/info/refs"},
+		{"unknown", "/repo/import", false, "unknown", "/repo/import"},
+		{"unknown", "/repo/import", true, "unknown/repo", "/import"},
+		{"unknown", "/import", true, "unknown", "/import"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name+tt.action, func(t *testing.T) {
+			gotRepoName, gotAction := ResolveRepoName(tt.name, tt.action, tt.allowNewNamespace)
+			if gotRepoName != tt.wantRepoName || gotAction != tt.wantAction {
+				t.Errorf("ResolveRepoName() = %v %v, want %v %v", gotRepoName, gotAction, tt.wantRepoName, tt.wantAction)
+			}
+		})
+	}
+}
+
+func TestResolveWebSocketRepoName(t *testing.T) {
+	baseDir, err := ioutil.TempDir("", "gitbox-test")
+	if err != nil {
+		t.Fatalf("error, %v", err)
+	}
+
+	defer os.RemoveAll(baseDir)
+
+	config.REPO_BASE_DIR = baseDir
+
+	for _, repoName := range []string{"flat", "owner/repo"} {
+		if err := CreateNewRepo(repoName); err != nil {
+			t.Fatalf("error, %v", err)
+		}
+	}
+
+	tests := []struct {
+		name         string
+		action       string
+		wantRepoName string
+	}{
+		{"flat", "/", "flat"},
+		{"flat", "/extra", "flat"},
+		{"owner", "/repo/", "owner/repo"},
+		{"owner", "/other", "owner/other"},
+		{"newowner", "/repo/", "newowner/repo"},
+		{"newflat", "/", "newflat"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name+tt.action, func(t *testing.T) {
+			if got := ResolveWebSocketRepoName(tt.name, tt.action); got != tt.wantRepoName {
+				t.Errorf("ResolveWebSocketRepoName() = %v, want %v", got, tt.wantRepoName)
 			}
 		})
 	}
 }
+
+func TestPageBounds(t *testing.T) {
+	tests := []struct {
+		name      string
+		total     int
+		pageNum   int64
+		perPage   int64
+		wantStart int
+		wantEnd   int
+	}{
+		{"first page", 5, 0, 2, 0, 2},
+		{"last partial page", 5, 2, 2, 4, 5},
+		{"past the end", 5, 3, 2, 5, 5},
+		{"empty listing", 0, 0, 2, 0, 0},
+		{"negative page", 5, -1, 2, 5, 5},
+		{"overflowing page", 5, math.MaxInt64, 2, 5, 5},
+		{"overflowing per page", 5, 1, math.MaxInt64, 5, 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotStart, gotEnd := PageBounds(tt.total, tt.pageNum, tt.perPage)
+			if gotStart != tt.wantStart || gotEnd != tt.wantEnd {
+				t.Errorf("PageBounds() = %v %v, want %v %v", gotStart, gotEnd, tt.wantStart, tt.wantEnd)
+			}
+		})
+	}
+}
+
+func TestTruncatePatch(t *testing.T) {
+	tests := []struct {
+		name          string
+		patch         string
+		maxSize       int64
+		wantPatch     string
+		wantTruncated bool
+	}{
+		{"fits", "+abc", 4, "+abc", false},
+		{"ascii", "+abcdef", 4, "+abc", true},
+		{"inside multi byte rune", "+a名前", 4, "+a", true},
+		{"at rune start", "+a名前", 5, "+a名", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotPatch, gotTruncated := truncatePatch([]byte(tt.patch), tt.maxSize)
+			if gotPatch != tt.wantPatch || gotTruncated != tt.wantTruncated || !utf8.ValidString(gotPatch) {
+				t.Errorf("truncatePatch() = %q %v, want %q %v", gotPatch, gotTruncated, tt.wantPatch, tt.wantTruncated)
+			}
+		})
+	}
+}
+
+func TestGraphLanes(t *testing.T) {
+	// m merges feature f into b, both branched from root a, and h is a separate head on a
+	walk := []struct {
+		sha             string
+		parents         []string
+		wantLane        int
+		wantParentLanes []int
+	}{
+		{"m", []string{"b", "f"}, 0, []int{0, 1}},
+		{"h", []string{"a"}, 2, []int{2}},
+		{"f", []string{"a"}, 1, []int{2}},
+		{"b", []string{"a"}, 0, []int{2}},
+		{"a", nil, 2, []int{}},
+	}
+
+	lanes := graphLanes{}
+
+	for _, commit := range walk {
+		lane, parentLanes := lanes.next(commit.sha, commit.parents)
+
+		if lane != commit.wantLane || !reflect.DeepEqual(parentLanes, commit.wantParentLanes) {
+			t.Errorf("lanes.next(%s) = %v %v, want %v %v", commit.sha, lane, parentLanes, commit.wantLane, commit.wantParentLanes)
+		}
+	}
+
+	if len(lanes) != 0 {
+		t.Errorf("lanes = %v, want all lanes freed", lanes)
+	}
+}